@@ -2,51 +2,282 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	"github.com/Gustik/shortener/internal/config"
+	"github.com/Gustik/shortener/internal/grpcserver"
 	"github.com/Gustik/shortener/internal/handler"
 	"github.com/Gustik/shortener/internal/repository"
 	"github.com/Gustik/shortener/internal/service"
+	"github.com/Gustik/shortener/internal/shortid"
+	"github.com/Gustik/shortener/internal/tlscert"
 	"github.com/Gustik/shortener/internal/zaplog"
 )
 
+const (
+	expiredSweepInterval = time.Minute
+	clicksFileSuffix     = ".clicks"
+	counterFileSuffix    = ".counter"
+)
+
 func main() {
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка загрузки конфигурации: %v\n", err)
+		os.Exit(1)
+	}
 
 	logger, err := zaplog.New(cfg.LogLevel)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Ошибка инициализации логгера: %v\n", err)
 		os.Exit(1)
 	}
-	defer logger.Sync()
+
+	if err := run(cfg, logger); err != nil {
+		logger.Error("Сервер завершился с ошибкой", zap.Error(err))
+		logger.Sync()
+		os.Exit(1)
+	}
+
+	logger.Sync()
+}
+
+// run запускает сервер и блокируется до сигнала остановки.
+// Отложенные вызовы закрывают фоновые задачи и репозиторий в обратном порядке создания.
+func run(cfg *config.Config, logger *zap.Logger) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
 
 	repo, cleanup, err := initRepository(cfg, logger)
 	if err != nil {
-		logger.Fatal("Ошибка инициализации репозитория", zap.Error(err))
+		return fmt.Errorf("ошибка инициализации репозитория: %w", err)
 	}
+	// Репозиторий закрываем последним, когда все очереди уже сброшены
 	defer cleanup()
 
-	svc := service.NewURLService(repo, cfg.BaseURL, logger)
+	deleter := service.NewURLDeleter(repo, logger)
+	defer deleter.Close()
+
+	sweeper := service.NewURLSweeper(repo, expiredSweepInterval, logger)
+	defer sweeper.Close()
+
+	clicks := service.NewClickRecorder(repo, logger)
+	defer clicks.Close()
+
+	ids, err := newShortIDGenerator(cfg, repo)
+	if err != nil {
+		return fmt.Errorf("ошибка инициализации генератора short_url: %w", err)
+	}
+
+	rules, err := initDestinationRules(ctx, cfg, logger)
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки правил адресов назначения: %w", err)
+	}
+
+	var network *service.PrivateNetworkGuard
+	if cfg.DenyPrivateNetworks {
+		network, err = service.NewPrivateNetworkGuard(net.DefaultResolver, cfg.AllowedInternalCIDRs)
+		if err != nil {
+			return fmt.Errorf("ошибка настройки проверки внутренних сетей: %w", err)
+		}
+	}
+
+	urls := service.NewURLValidator(cfg.AllowedSchemes, service.NormalizeOptions{
+		StripFragment: cfg.StripFragment,
+		SortQuery:     cfg.SortQuery,
+	}, rules, network)
+
+	svc := service.NewURLService(repo, deleter, clicks, ids, urls, cfg.BaseURL, logger)
 	h := handler.NewURLHandler(svc, logger)
 
-	router := handler.SetupRoutes(h)
+	server := &http.Server{
+		Addr:    cfg.ServerAddress.String(),
+		Handler: handler.SetupRoutes(h, cfg.SecretKey, cfg.TrustedSubnet),
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.EnableHTTPS {
+		tlsConfig, err = loadTLSConfig(cfg, logger)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = tlsConfig
+	}
+
+	grpcOpts := []grpc.ServerOption{}
+	if tlsConfig != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	grpcServer := grpcserver.NewServer(grpcserver.NewShortenerServer(svc, logger), cfg.SecretKey, grpcOpts...)
 
-	logger.Sugar().Infof("Запускаем сервер по адресу %s", cfg.ServerAddress.String())
+	grpcListener, err := net.Listen("tcp", cfg.GRPCAddress.String())
+	if err != nil {
+		return fmt.Errorf("ошибка при запуске gRPC-сервера: %w", err)
+	}
+
+	serverErr := make(chan error, 2)
+	go func() {
+		logger.Sugar().Infof("Запускаем сервер по адресу %s", cfg.ServerAddress.String())
+		if err := listenAndServe(server, cfg); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- fmt.Errorf("ошибка при запуске сервера: %w", err)
+		}
+	}()
+	go func() {
+		logger.Sugar().Infof("Запускаем gRPC-сервер по адресу %s", cfg.GRPCAddress.String())
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			serverErr <- fmt.Errorf("ошибка при запуске gRPC-сервера: %w", err)
+		}
+	}()
 
-	if err := http.ListenAndServe(cfg.ServerAddress.String(), router); err != nil {
-		logger.Fatal("Ошибка при запуске сервера", zap.Error(err))
+	select {
+	case err := <-serverErr:
+		server.Close()
+		grpcServer.Stop()
+		return err
+	case <-ctx.Done():
+		logger.Info("Получен сигнал остановки, завершаем работу")
 	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Перестаем принимать соединения и ждем завершения обрабатываемых запросов на обоих серверах
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Не удалось дождаться завершения запросов", zap.Error(err))
+	}
+
+	select {
+	case <-grpcStopped:
+	case <-shutdownCtx.Done():
+		logger.Error("Не удалось дождаться завершения gRPC-запросов")
+		grpcServer.Stop()
+	}
+
+	logger.Info("Сервер остановлен, сбрасываем фоновые очереди")
+
+	return nil
+}
+
+// listenAndServe запускает сервер по HTTP или HTTPS, сертификат уже лежит в TLSConfig
+func listenAndServe(server *http.Server, cfg *config.Config) error {
+	if !cfg.EnableHTTPS {
+		return server.ListenAndServe()
+	}
+	return server.ListenAndServeTLS("", "")
+}
+
+// loadTLSConfig загружает сертификат из файлов, а если они не заданы, выпускает самоподписанный.
+// Один и тот же сертификат используют HTTP и gRPC серверы.
+func loadTLSConfig(cfg *config.Config, logger *zap.Logger) (*tls.Config, error) {
+	// Без одного из файлов молча подставлять самоподписанный сертификат нельзя
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, errors.New("сертификат и ключ TLS задаются вместе: укажите и tls-cert, и tls-key")
+	}
+
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка загрузки сертификата: %w", err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+	}
+
+	logger.Warn("Сертификат не задан, используем самоподписанный")
+	cert, err := tlscert.SelfSigned(cfg.ServerAddress.Host, cfg.GRPCAddress.Host)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания самоподписанного сертификата: %w", err)
+	}
+
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// newShortIDGenerator выбирает стратегию генерации short_url, счетчики берут значения из репозитория.
+// Если задан список запрещенных слов, кандидаты с ними отбрасываются до сохранения.
+func newShortIDGenerator(cfg *config.Config, repo repository.URLRepository) (service.ShortIDGenerator, error) {
+	alphabet := shortid.Base62Alphabet
+	if cfg.ShortIDAlphabet == config.ShortIDAlphabetHuman {
+		alphabet = shortid.HumanAlphabet
+	}
+
+	var ids shortid.Generator
+	switch cfg.ShortIDStrategy {
+	case config.ShortIDCounter:
+		ids = shortid.NewCounter(repo, alphabet, cfg.ShortIDLength)
+	case config.ShortIDHash:
+		ids = shortid.NewHash(alphabet, cfg.ShortIDLength)
+	case config.ShortIDSqids:
+		ids = shortid.NewSqids(repo, alphabet, cfg.ShortIDLength)
+	default:
+		ids = shortid.NewRandom(alphabet, cfg.ShortIDLength)
+	}
+
+	if cfg.ShortIDBlocklist == "" {
+		return ids, nil
+	}
+
+	blocked, err := shortid.LoadBlocklist(cfg.ShortIDBlocklist)
+	if err != nil {
+		return nil, err
+	}
+
+	return shortid.NewFiltered(ids, blocked), nil
+}
+
+// initDestinationRules загружает правила адресов назначения, если задан файл,
+// и перечитывает их по SIGHUP до завершения ctx
+func initDestinationRules(ctx context.Context, cfg *config.Config, logger *zap.Logger) (*service.DestinationRules, error) {
+	if cfg.URLRulesFile == "" {
+		return nil, nil
+	}
+
+	rules, err := service.NewDestinationRules(cfg.URLRulesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(reload)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-reload:
+				if err := rules.Reload(); err != nil {
+					logger.Error("Не удалось перечитать правила адресов назначения", zap.Error(err))
+					continue
+				}
+				logger.Info("Правила адресов назначения перечитаны", zap.String("path", cfg.URLRulesFile))
+			}
+		}
+	}()
+
+	return rules, nil
 }
 
 func initRepository(cfg *config.Config, logger *zap.Logger) (repository.URLRepository, func(), error) {
@@ -74,15 +305,34 @@ func initFileRepository(cfg *config.Config, logger *zap.Logger) (repository.URLR
 		return nil, nil, fmt.Errorf("ошибка открытия файла репозитория: %w", err)
 	}
 
-	repo, err := repository.NewFileURLRepository(file)
+	// Журнал переходов лежит рядом с файлом ссылок
+	clicksPath := cfg.FileStoragePath + clicksFileSuffix
+	clicksFile, err := os.OpenFile(clicksPath, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		file.Close()
+		return nil, nil, fmt.Errorf("ошибка открытия журнала переходов: %w", err)
+	}
+
+	counterPath := cfg.FileStoragePath + counterFileSuffix
+	counterFile, err := os.OpenFile(counterPath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		file.Close()
+		clicksFile.Close()
+		return nil, nil, fmt.Errorf("ошибка открытия файла счетчика: %w", err)
+	}
+
+	repo, err := repository.NewFileURLRepository(file, clicksFile, counterFile)
+	if err != nil {
+		file.Close()
+		clicksFile.Close()
+		counterFile.Close()
 		return nil, nil, fmt.Errorf("ошибка инициализации file репозитория: %w", err)
 	}
 
 	cleanup := func() {
-		if err := file.Close(); err != nil {
-			logger.Error("Ошибка закрытия файла репозитория", zap.Error(err))
+		logger.Info("Закрываю файлы репозитория")
+		if err := repo.Close(); err != nil {
+			logger.Error("Ошибка закрытия файлов репозитория", zap.Error(err))
 		}
 	}
 
@@ -97,30 +347,37 @@ func initSQLRepository(cfg *config.Config, logger *zap.Logger) (repository.URLRe
 	logger.Info("Миграции успешно применены")
 
 	logger.Info("Подключение к PostgreSQL")
-	conn, err := pgx.Connect(context.Background(), cfg.DatabaseDSN)
+	poolConfig, err := pgxpool.ParseConfig(cfg.DatabaseDSN)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка разбора DSN: %w", err)
+	}
+	poolConfig.MaxConns = int32(cfg.DBMaxConns)
+	poolConfig.MinConns = int32(min(cfg.DBMinConns, cfg.DBMaxConns))
+	poolConfig.MaxConnIdleTime = cfg.DBMaxConnIdleTime
+	poolConfig.MaxConnLifetime = cfg.DBMaxConnLifetime
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, nil, fmt.Errorf("ошибка подключения к БД: %w", err)
 	}
 
-	repo, err := repository.NewSQLRepository(conn)
+	repo, err := repository.NewSQLRepository(pool)
 	if err != nil {
-		conn.Close(context.Background())
+		pool.Close()
 		return nil, nil, fmt.Errorf("ошибка инициализации SQL репозитория: %w", err)
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := repo.Ping(ctx); err != nil {
-		conn.Close(context.Background())
+		pool.Close()
 		return nil, nil, fmt.Errorf("ошибка проверки подключения к БД: %w", err)
 	}
-	logger.Info("Успешное подключение к PostgreSQL")
+	logger.Info("Успешное подключение к PostgreSQL", zap.Int32("max_conns", poolConfig.MaxConns))
 
 	cleanup := func() {
-		logger.Info("Закрываю соединение с posgtres")
-		if err := conn.Close(context.Background()); err != nil {
-			logger.Error("Ошибка закрытия подключения к БД", zap.Error(err))
-		}
+		logger.Info("Закрываю пул соединений с postgres")
+		pool.Close()
 	}
 
 	return repo, cleanup, nil
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidToken = errors.New("invalid auth token")
+
+type contextKey struct{}
+
+// NewUserID генерирует идентификатор нового пользователя
+func NewUserID() string {
+	return uuid.NewString()
+}
+
+// Sign формирует подписанный токен вида <userID>.<hmac-sha256>
+func Sign(userID string, secret []byte) string {
+	return userID + "." + hex.EncodeToString(signature(userID, secret))
+}
+
+// Verify проверяет подпись токена и возвращает идентификатор пользователя
+func Verify(token string, secret []byte) (string, error) {
+	idx := strings.LastIndex(token, ".")
+	if idx <= 0 || idx == len(token)-1 {
+		return "", ErrInvalidToken
+	}
+
+	userID, sig := token[:idx], token[idx+1:]
+
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	if !hmac.Equal(got, signature(userID, secret)) {
+		return "", ErrInvalidToken
+	}
+
+	return userID, nil
+}
+
+// WithUserID кладет идентификатор пользователя в контекст
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, userID)
+}
+
+// UserIDFromContext достает идентификатор пользователя из контекста
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(contextKey{}).(string)
+	return userID, ok && userID != ""
+}
+
+func signature(userID string, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(userID))
+	return mac.Sum(nil)
+}
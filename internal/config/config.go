@@ -1,12 +1,16 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -15,10 +19,37 @@ const (
 	StorageSQL  string = "sql"
 )
 
+// Стратегии генерации short_url
+const (
+	ShortIDRandom  string = "random"
+	ShortIDCounter string = "counter"
+	ShortIDHash    string = "hash"
+	ShortIDSqids   string = "sqids"
+)
+
+// Алфавиты short_url
+const (
+	ShortIDAlphabetBase62 string = "base62"
+	// ShortIDAlphabetHuman без похожих символов, удобен для диктовки
+	ShortIDAlphabetHuman string = "human"
+)
+
 const (
 	defaultServerAddress = "localhost:8080"
+	defaultGRPCAddress   = "localhost:3200"
 	defaultBaseURL       = "http://localhost:8080"
+	defaultHTTPSBaseURL  = "https://localhost:8080"
 	defaultLogLevel      = "info"
+	defaultShutdown      = 10 * time.Second
+	defaultShortIDLength = 8
+	minShortIDLength     = 4
+	defaultSchemes       = "http,https"
+	secretKeyBytes       = 32
+
+	defaultDBMaxConns        = 10
+	defaultDBMinConns        = 0
+	defaultDBMaxConnIdleTime = 5 * time.Minute
+	defaultDBMaxConnLifetime = time.Hour
 )
 
 type NetAddr struct {
@@ -53,42 +84,131 @@ func (n *NetAddr) Set(value string) error {
 
 type Config struct {
 	ServerAddress   NetAddr
+	GRPCAddress     NetAddr
 	BaseURL         string
 	LogLevel        string
 	FileStoragePath string
 	DatabaseDSN     string
-	StorageType     string
+	// Настройки пула соединений с БД
+	DBMaxConns        int
+	DBMinConns        int
+	DBMaxConnIdleTime time.Duration
+	DBMaxConnLifetime time.Duration
+	StorageType       string
+	SecretKey         string
+	TrustedSubnet     string
+	ShutdownTimeout   time.Duration
+	EnableHTTPS       bool
+	TLSCertFile       string
+	TLSKeyFile        string
+	ShortIDStrategy   string
+	// ShortIDLength длина случайных и хеш-идентификаторов, для счетчиков минимальная длина
+	ShortIDLength   int
+	ShortIDAlphabet string
+	// ShortIDBlocklist путь к файлу со словами, которых не должно быть в short_url
+	ShortIDBlocklist string
+	// AllowedSchemes схемы URL, которые можно сокращать
+	AllowedSchemes []string
+	// StripFragment и SortQuery включают необязательные шаги нормализации URL
+	StripFragment bool
+	SortQuery     bool
+	// URLRulesFile путь к файлу правил block/allow для адресов назначения, перечитывается по SIGHUP
+	URLRulesFile string
+	// DenyPrivateNetworks запрещает ссылки на адреса внутренних сетей,
+	// кроме подсетей из AllowedInternalCIDRs
+	DenyPrivateNetworks  bool
+	AllowedInternalCIDRs []string
 }
 
 type Flags struct {
-	ServerAddr      string
-	BaseURL         string
-	LogLevel        string
-	FileStoragePath string
-	DatabaseDSN     string
+	ConfigFile           string
+	ServerAddr           string
+	GRPCAddr             string
+	BaseURL              string
+	LogLevel             string
+	FileStoragePath      string
+	DatabaseDSN          string
+	DBMaxConns           string
+	DBMinConns           string
+	DBMaxConnIdleTime    string
+	DBMaxConnLifetime    string
+	SecretKey            string
+	TrustedSubnet        string
+	ShutdownTimeout      string
+	EnableHTTPS          *bool
+	TLSCertFile          string
+	TLSKeyFile           string
+	ShortIDStrategy      string
+	ShortIDLength        string
+	ShortIDAlphabet      string
+	ShortIDBlocklist     string
+	AllowedSchemes       string
+	StripFragment        *bool
+	SortQuery            *bool
+	URLRulesFile         string
+	DenyPrivateNetworks  *bool
+	AllowedInternalCIDRs string
 }
 
-func Load() *Config {
+// Load собирает конфигурацию из нескольких источников.
+// Приоритет по возрастанию: значения по умолчанию, JSON-файл, флаги, переменные окружения.
+// Если файл конфигурации указан, но не читается или не разбирается, возвращается ошибка.
+func Load() (*Config, error) {
 	cfg := &Config{}
 
 	cfg.ServerAddress.Set(defaultServerAddress)
+	cfg.GRPCAddress.Set(defaultGRPCAddress)
 	cfg.BaseURL = defaultBaseURL
 	cfg.LogLevel = defaultLogLevel
 	cfg.StorageType = StorageMem
 
 	flags := parseFlags()
 
-	if envServerAddr, ok := os.LookupEnv("SERVER_ADDRESS"); ok {
-		cfg.ServerAddress.Set(envServerAddr)
-	} else if flags.ServerAddr != "" {
-		cfg.ServerAddress.Set(flags.ServerAddr)
+	file := &FileConfig{}
+	if path := getConfigValue("CONFIG", flags.ConfigFile, ""); path != "" {
+		var err error
+		if file, err = loadFile(path); err != nil {
+			return nil, fmt.Errorf("не удалось загрузить файл конфигурации: %w", err)
+		}
 	}
 
-	cfg.BaseURL = getConfigValue("BASE_URL", flags.BaseURL, defaultBaseURL)
-	cfg.LogLevel = getConfigValue("LOG_LEVEL", flags.LogLevel, defaultLogLevel)
+	cfg.ServerAddress.Set(getConfigValue("SERVER_ADDRESS", flags.ServerAddr, withDefault(file.ServerAddress, defaultServerAddress)))
+	cfg.GRPCAddress.Set(getConfigValue("GRPC_ADDRESS", flags.GRPCAddr, withDefault(file.GRPCAddress, defaultGRPCAddress)))
 
-	cfg.FileStoragePath = getConfigValue("FILE_STORAGE_PATH", flags.FileStoragePath, "")
-	cfg.DatabaseDSN = getConfigValue("DATABASE_DSN", flags.DatabaseDSN, "")
+	cfg.EnableHTTPS = getBoolValue("ENABLE_HTTPS", flags.EnableHTTPS, file.EnableHTTPS)
+	cfg.TLSCertFile = getConfigValue("TLS_CERT_FILE", flags.TLSCertFile, file.TLSCertFile)
+	cfg.TLSKeyFile = getConfigValue("TLS_KEY_FILE", flags.TLSKeyFile, file.TLSKeyFile)
+
+	baseURL := defaultBaseURL
+	if cfg.EnableHTTPS {
+		baseURL = defaultHTTPSBaseURL
+	}
+	cfg.BaseURL = getConfigValue("BASE_URL", flags.BaseURL, withDefault(file.BaseURL, baseURL))
+	cfg.LogLevel = getConfigValue("LOG_LEVEL", flags.LogLevel, withDefault(file.LogLevel, defaultLogLevel))
+
+	cfg.FileStoragePath = getConfigValue("FILE_STORAGE_PATH", flags.FileStoragePath, file.FileStoragePath)
+	cfg.DatabaseDSN = getConfigValue("DATABASE_DSN", flags.DatabaseDSN, file.DatabaseDSN)
+	cfg.DBMaxConns = getIntValue("DB_MAX_CONNS", withDefault(flags.DBMaxConns, intString(file.DBMaxConns)), defaultDBMaxConns, 1)
+	cfg.DBMinConns = getIntValue("DB_MIN_CONNS", withDefault(flags.DBMinConns, intString(file.DBMinConns)), defaultDBMinConns, 0)
+	cfg.DBMaxConnIdleTime = getDurationValue("DB_MAX_CONN_IDLE_TIME", withDefault(flags.DBMaxConnIdleTime, file.DBMaxConnIdleTime), defaultDBMaxConnIdleTime)
+	cfg.DBMaxConnLifetime = getDurationValue("DB_MAX_CONN_LIFETIME", withDefault(flags.DBMaxConnLifetime, file.DBMaxConnLifetime), defaultDBMaxConnLifetime)
+	cfg.SecretKey = getConfigValue("SECRET_KEY", flags.SecretKey, file.SecretKey)
+	if cfg.SecretKey == "" {
+		cfg.SecretKey = generateSecretKey()
+		log.Println("ВНИМАНИЕ: ключ подписи куки не задан, сгенерирован случайный; после перезапуска выданные куки станут недействительны")
+	}
+	cfg.TrustedSubnet = getConfigValue("TRUSTED_SUBNET", flags.TrustedSubnet, file.TrustedSubnet)
+	cfg.ShutdownTimeout = getDurationValue("SHUTDOWN_TIMEOUT", withDefault(flags.ShutdownTimeout, file.ShutdownTimeout), defaultShutdown)
+	cfg.ShortIDStrategy = getOneOf("SHORT_ID_STRATEGY", withDefault(flags.ShortIDStrategy, file.ShortIDStrategy), ShortIDRandom, ShortIDCounter, ShortIDHash, ShortIDSqids)
+	cfg.ShortIDLength = getIntValue("SHORT_ID_LENGTH", withDefault(flags.ShortIDLength, intString(file.ShortIDLength)), defaultShortIDLength, minShortIDLength)
+	cfg.ShortIDAlphabet = getOneOf("SHORT_ID_ALPHABET", withDefault(flags.ShortIDAlphabet, file.ShortIDAlphabet), ShortIDAlphabetBase62, ShortIDAlphabetHuman)
+	cfg.ShortIDBlocklist = getConfigValue("SHORT_ID_BLOCKLIST", flags.ShortIDBlocklist, file.ShortIDBlocklist)
+	cfg.AllowedSchemes = getListValue("ALLOWED_SCHEMES", withDefault(flags.AllowedSchemes, strings.Join(file.AllowedSchemes, ",")), defaultSchemes)
+	cfg.StripFragment = getBoolValue("URL_STRIP_FRAGMENT", flags.StripFragment, file.StripFragment)
+	cfg.SortQuery = getBoolValue("URL_SORT_QUERY", flags.SortQuery, file.SortQuery)
+	cfg.URLRulesFile = getConfigValue("URL_RULES_FILE", flags.URLRulesFile, file.URLRulesFile)
+	cfg.DenyPrivateNetworks = getBoolValue("DENY_PRIVATE_NETWORKS", flags.DenyPrivateNetworks, file.DenyPrivateNetworks)
+	cfg.AllowedInternalCIDRs = getListValue("ALLOWED_INTERNAL_CIDRS", withDefault(flags.AllowedInternalCIDRs, strings.Join(file.AllowedInternalCIDRs, ",")), "")
 
 	if cfg.DatabaseDSN != "" {
 		cfg.StorageType = StorageSQL
@@ -98,18 +218,55 @@ func Load() *Config {
 
 	printConfigInfo(cfg)
 
-	return cfg
+	return cfg, nil
 }
 
 func parseFlags() *Flags {
 	f := &Flags{}
+	var enableHTTPS, stripFragment, sortQuery, denyPrivate bool
+	flag.StringVar(&f.ConfigFile, "c", "", "путь к JSON-файлу конфигурации")
 	flag.StringVar(&f.ServerAddr, "a", "", "адрес и порт сервера в формате host:port")
+	flag.StringVar(&f.GRPCAddr, "g", "", "адрес и порт gRPC-сервера в формате host:port")
 	flag.StringVar(&f.BaseURL, "b", "", "базовый URL для сокращенных ссылок")
 	flag.StringVar(&f.FileStoragePath, "f", "", "путь файла данных")
 	flag.StringVar(&f.DatabaseDSN, "d", "", "DSN подключения к бд")
+	flag.StringVar(&f.DBMaxConns, "db-max-conns", "", "максимальное число соединений в пуле БД")
+	flag.StringVar(&f.DBMinConns, "db-min-conns", "", "минимальное число соединений в пуле БД")
+	flag.StringVar(&f.DBMaxConnIdleTime, "db-max-conn-idle-time", "", "время простоя, после которого соединение с БД закрывается, например 5m")
+	flag.StringVar(&f.DBMaxConnLifetime, "db-max-conn-lifetime", "", "максимальное время жизни соединения с БД, например 1h")
 	flag.StringVar(&f.LogLevel, "l", "", "уровень логирования")
+	flag.StringVar(&f.SecretKey, "k", "", "ключ подписи авторизационной куки")
+	flag.StringVar(&f.TrustedSubnet, "t", "", "доверенная подсеть в формате CIDR")
+	flag.StringVar(&f.ShutdownTimeout, "shutdown-timeout", "", "время ожидания завершения запросов при остановке, например 10s")
+	flag.BoolVar(&enableHTTPS, "s", false, "включить HTTPS")
+	flag.StringVar(&f.TLSCertFile, "tls-cert", "", "путь к файлу TLS-сертификата")
+	flag.StringVar(&f.TLSKeyFile, "tls-key", "", "путь к файлу ключа TLS-сертификата")
+	flag.StringVar(&f.ShortIDStrategy, "id-strategy", "", "стратегия генерации short_url: random, counter, hash или sqids")
+	flag.StringVar(&f.ShortIDLength, "id-length", "", "длина short_url")
+	flag.StringVar(&f.ShortIDAlphabet, "id-alphabet", "", "алфавит short_url: base62 или human")
+	flag.StringVar(&f.ShortIDBlocklist, "id-blocklist", "", "путь к файлу со словами, запрещенными в short_url")
+	flag.StringVar(&f.AllowedSchemes, "allowed-schemes", "", "разрешенные схемы URL через запятую, например http,https")
+	flag.BoolVar(&stripFragment, "strip-fragment", false, "убирать #fragment из сокращаемых URL")
+	flag.BoolVar(&sortQuery, "sort-query", false, "сортировать параметры запроса в сокращаемых URL")
+	flag.StringVar(&f.URLRulesFile, "url-rules", "", "путь к файлу правил block/allow для адресов назначения")
+	flag.BoolVar(&denyPrivate, "deny-private-networks", false, "запретить ссылки на адреса внутренних сетей")
+	flag.StringVar(&f.AllowedInternalCIDRs, "allowed-internal-cidrs", "", "внутренние подсети через запятую, на которые разрешены ссылки")
 	flag.Parse()
 
+	// Логические флаги нужно отличать от незаданных, иначе они перекроют значения из файла
+	flag.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "s":
+			f.EnableHTTPS = &enableHTTPS
+		case "strip-fragment":
+			f.StripFragment = &stripFragment
+		case "sort-query":
+			f.SortQuery = &sortQuery
+		case "deny-private-networks":
+			f.DenyPrivateNetworks = &denyPrivate
+		}
+	})
+
 	return f
 }
 
@@ -123,14 +280,125 @@ func getConfigValue(envKey, flagValue, defaultValue string) string {
 	return defaultValue
 }
 
+// getDurationValue как getConfigValue, но разбирает длительность.
+// Некорректное значение логируется и заменяется значением по умолчанию.
+func getDurationValue(envKey, flagValue string, defaultValue time.Duration) time.Duration {
+	value := getConfigValue(envKey, flagValue, "")
+	if value == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("некорректное значение %s=%q, используется %s", envKey, value, defaultValue)
+		return defaultValue
+	}
+
+	return d
+}
+
+// getIntValue как getDurationValue, но разбирает целое число не меньше minValue
+func getIntValue(envKey, flagValue string, defaultValue, minValue int) int {
+	value := getConfigValue(envKey, flagValue, "")
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < minValue {
+		log.Printf("некорректное значение %s=%q, используется %d", envKey, value, defaultValue)
+		return defaultValue
+	}
+
+	return n
+}
+
+// getBoolValue разбирает логическое значение из окружения, иначе берет флаг.
+// flagValue равен nil, если флаг не передан. Некорректное значение окружения логируется и игнорируется.
+func getBoolValue(envKey string, flagValue *bool, defaultValue bool) bool {
+	fallback := defaultValue
+	if flagValue != nil {
+		fallback = *flagValue
+	}
+
+	envValue, ok := os.LookupEnv(envKey)
+	if !ok || envValue == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(envValue)
+	if err != nil {
+		log.Printf("некорректное значение %s=%q, используется %t", envKey, envValue, fallback)
+		return fallback
+	}
+
+	return b
+}
+
+// getListValue разбирает список через запятую, пустые элементы отбрасываются
+func getListValue(envKey, flagValue, defaultValue string) []string {
+	var list []string
+	for _, item := range strings.Split(getConfigValue(envKey, flagValue, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// getOneOf как getConfigValue, но допускает только значения из allowed.
+// Первое из них используется по умолчанию, неизвестное значение логируется и заменяется им.
+func getOneOf(envKey, flagValue string, allowed ...string) string {
+	value := getConfigValue(envKey, flagValue, "")
+	if value == "" {
+		return allowed[0]
+	}
+
+	if slices.Contains(allowed, value) {
+		return value
+	}
+
+	log.Printf("некорректное значение %s=%q, используется %s", envKey, value, allowed[0])
+	return allowed[0]
+}
+
+// generateSecretKey возвращает случайный ключ подписи куки
+func generateSecretKey() string {
+	b := make([]byte, secretKeyBytes)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// withDefault возвращает value, а если оно пустое, то defaultValue
+func withDefault(value, defaultValue string) string {
+	if value != "" {
+		return value
+	}
+	return defaultValue
+}
+
 func printConfigInfo(cfg *Config) {
 	log.Println("Конфигурация загружена")
 	log.Println("---")
 	log.Println("addr:", cfg.ServerAddress.String())
+	log.Println("grpcAddr:", cfg.GRPCAddress.String())
 	log.Println("baseURL:", cfg.BaseURL)
 	log.Println("logLevel:", cfg.LogLevel)
 	log.Println("fileStoragePath:", cfg.FileStoragePath)
 	log.Println("databaseDSN:", cfg.DatabaseDSN)
+	log.Println("dbPool:", cfg.DBMinConns, "-", cfg.DBMaxConns, "conns, idle", cfg.DBMaxConnIdleTime, "lifetime", cfg.DBMaxConnLifetime)
 	log.Println("storageType:", cfg.StorageType)
+	log.Println("trustedSubnet:", cfg.TrustedSubnet)
+	log.Println("shutdownTimeout:", cfg.ShutdownTimeout)
+	log.Println("enableHTTPS:", cfg.EnableHTTPS)
+	log.Println("tlsCertFile:", cfg.TLSCertFile)
+	log.Println("tlsKeyFile:", cfg.TLSKeyFile)
+	log.Println("shortID:", cfg.ShortIDStrategy, "length", cfg.ShortIDLength, "alphabet", cfg.ShortIDAlphabet)
+	log.Println("shortIDBlocklist:", cfg.ShortIDBlocklist)
+	log.Println("allowedSchemes:", cfg.AllowedSchemes)
+	log.Println("urlNormalize: stripFragment", cfg.StripFragment, "sortQuery", cfg.SortQuery)
+	log.Println("urlRulesFile:", cfg.URLRulesFile)
+	log.Println("denyPrivateNetworks:", cfg.DenyPrivateNetworks, "allowed", cfg.AllowedInternalCIDRs)
 	log.Println("---")
 }
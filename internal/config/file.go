@@ -0,0 +1,61 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// FileConfig описывает JSON-файл конфигурации. Ключи повторяют поля Config,
+// тип хранилища не задается, а выводится из file_storage_path и database_dsn.
+type FileConfig struct {
+	ServerAddress        string   `json:"server_address"`
+	GRPCAddress          string   `json:"grpc_address"`
+	BaseURL              string   `json:"base_url"`
+	LogLevel             string   `json:"log_level"`
+	FileStoragePath      string   `json:"file_storage_path"`
+	DatabaseDSN          string   `json:"database_dsn"`
+	DBMaxConns           *int     `json:"db_max_conns"`
+	DBMinConns           *int     `json:"db_min_conns"`
+	DBMaxConnIdleTime    string   `json:"db_max_conn_idle_time"`
+	DBMaxConnLifetime    string   `json:"db_max_conn_lifetime"`
+	SecretKey            string   `json:"secret_key"`
+	TrustedSubnet        string   `json:"trusted_subnet"`
+	ShutdownTimeout      string   `json:"shutdown_timeout"`
+	EnableHTTPS          bool     `json:"enable_https"`
+	TLSCertFile          string   `json:"tls_cert_file"`
+	TLSKeyFile           string   `json:"tls_key_file"`
+	ShortIDStrategy      string   `json:"short_id_strategy"`
+	ShortIDLength        *int     `json:"short_id_length"`
+	ShortIDAlphabet      string   `json:"short_id_alphabet"`
+	ShortIDBlocklist     string   `json:"short_id_blocklist"`
+	AllowedSchemes       []string `json:"allowed_schemes"`
+	StripFragment        bool     `json:"strip_fragment"`
+	SortQuery            bool     `json:"sort_query"`
+	URLRulesFile         string   `json:"url_rules_file"`
+	DenyPrivateNetworks  bool     `json:"deny_private_networks"`
+	AllowedInternalCIDRs []string `json:"allowed_internal_cidrs"`
+}
+
+// intString переводит необязательное число из файла в строку, как у флагов
+func intString(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+func loadFile(path string) (*FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения %s: %w", path, err)
+	}
+
+	var fc FileConfig
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("ошибка разбора %s: %w", path, err)
+	}
+
+	return &fc, nil
+}
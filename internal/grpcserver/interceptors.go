@@ -0,0 +1,79 @@
+package grpcserver
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Gustik/shortener/internal/auth"
+	pb "github.com/Gustik/shortener/pkg/shortenerpb"
+)
+
+// AuthMetadataKey ключ метаданных с подписанным токеном пользователя, как кука в HTTP API
+const AuthMetadataKey = "user_id"
+
+// protectedMethods требуют валидный токен, аналог RequireAuthMiddleware
+var protectedMethods = map[string]struct{}{
+	pb.Shortener_ListUserURLs_FullMethodName:   {},
+	pb.Shortener_DeleteUserURLs_FullMethodName: {},
+}
+
+// AuthInterceptor проверяет токен пользователя в метаданных.
+// Для открытых методов при отсутствии валидного токена выдает новый в заголовке ответа,
+// защищенные методы без токена получают Unauthenticated.
+func AuthInterceptor(secret []byte, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		userID, err := userIDFromMetadata(ctx, secret)
+		if err == nil {
+			return handler(auth.WithUserID(ctx, userID), req)
+		}
+
+		if _, ok := protectedMethods[info.FullMethod]; ok {
+			return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+		}
+		logger.Debug("no valid auth token, issuing new one", zap.Error(err))
+
+		userID = auth.NewUserID()
+		if err := grpc.SetHeader(ctx, metadata.Pairs(AuthMetadataKey, auth.Sign(userID, secret))); err != nil {
+			logger.Warn("failed to send auth token", zap.Error(err))
+		}
+
+		return handler(auth.WithUserID(ctx, userID), req)
+	}
+}
+
+// LoggingInterceptor логирует вызовы по аналогии с RequestLogger
+func LoggingInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		duration := time.Since(start)
+
+		logger.Sugar().Infoln(
+			"method", info.FullMethod,
+			"code", status.Code(err),
+			"duration", duration,
+		)
+
+		return resp, err
+	}
+}
+
+func userIDFromMetadata(ctx context.Context, secret []byte) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", auth.ErrInvalidToken
+	}
+
+	values := md.Get(AuthMetadataKey)
+	if len(values) == 0 {
+		return "", auth.ErrInvalidToken
+	}
+
+	return auth.Verify(values[0], secret)
+}
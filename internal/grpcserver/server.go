@@ -0,0 +1,270 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/Gustik/shortener/internal/auth"
+	"github.com/Gustik/shortener/internal/model"
+	"github.com/Gustik/shortener/internal/service"
+	pb "github.com/Gustik/shortener/pkg/shortenerpb"
+)
+
+// ShortenerServer реализует gRPC API поверх того же URLService, что и HTTP-хендлеры
+type ShortenerServer struct {
+	pb.UnimplementedShortenerServer
+
+	service service.URLService
+	logger  *zap.Logger
+}
+
+func NewShortenerServer(service service.URLService, logger *zap.Logger) *ShortenerServer {
+	return &ShortenerServer{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// NewServer собирает gRPC-сервер с логированием и авторизацией по метаданным
+func NewServer(shortener *ShortenerServer, secretKey string, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(
+		LoggingInterceptor(shortener.logger),
+		AuthInterceptor([]byte(secretKey), shortener.logger),
+	))
+
+	server := grpc.NewServer(opts...)
+	pb.RegisterShortenerServer(server, shortener)
+
+	return server
+}
+
+func (s *ShortenerServer) Shorten(ctx context.Context, req *pb.ShortenRequest) (*pb.ShortenResponse, error) {
+	userID, _ := auth.UserIDFromContext(ctx)
+
+	ttl, err := service.TTLFromSeconds(req.GetTtlSeconds())
+	if err != nil {
+		return nil, s.shortenError(err)
+	}
+
+	shortURL, err := s.service.ShortenURL(ctx, req.GetUrl(), userID, service.ShortenOptions{
+		CustomAlias: req.GetCustomAlias(),
+		ExpiresAt:   timeFromProto(req.GetExpiresAt()),
+		TTL:         ttl,
+		MaxClicks:   req.GetMaxClicks(),
+		Password:    req.GetPassword(),
+	})
+	if errors.Is(err, service.ErrURLExists) {
+		return &pb.ShortenResponse{ShortUrl: shortURL, AlreadyExists: true}, nil
+	}
+
+	if err != nil {
+		return nil, s.shortenError(err)
+	}
+
+	return &pb.ShortenResponse{ShortUrl: shortURL}, nil
+}
+
+func (s *ShortenerServer) ShortenBatch(ctx context.Context, req *pb.ShortenBatchRequest) (*pb.ShortenBatchResponse, error) {
+	userID, _ := auth.UserIDFromContext(ctx)
+
+	urls := make([]model.BatchRequest, len(req.GetItems()))
+	for i, item := range req.GetItems() {
+		urls[i] = model.BatchRequest{
+			CorrelationID: item.GetCorrelationId(),
+			OriginalURL:   item.GetOriginalUrl(),
+			CustomAlias:   item.GetCustomAlias(),
+			ExpiresAt:     timeFromProto(item.GetExpiresAt()),
+			TTL:           item.GetTtlSeconds(),
+			MaxClicks:     item.GetMaxClicks(),
+			Password:      item.GetPassword(),
+		}
+	}
+
+	resp, err := s.service.ShortenURLBatch(ctx, urls, userID)
+	if err != nil {
+		return nil, s.shortenError(err)
+	}
+
+	items := make([]*pb.BatchResult, len(resp))
+	for i := range resp {
+		items[i] = &pb.BatchResult{
+			CorrelationId: resp[i].CorrelationID,
+			ShortUrl:      resp[i].ShortURL,
+			Existing:      resp[i].Existing,
+		}
+	}
+
+	return &pb.ShortenBatchResponse{Items: items}, nil
+}
+
+func (s *ShortenerServer) GetOriginal(ctx context.Context, req *pb.GetOriginalRequest) (*pb.GetOriginalResponse, error) {
+	var (
+		originalURL string
+		err         error
+	)
+	if req.GetPassword() != "" {
+		originalURL, err = s.service.UnlockURL(ctx, req.GetShortId(), req.GetPassword())
+	} else {
+		originalURL, err = s.service.GetOriginalURL(ctx, req.GetShortId())
+	}
+
+	if err != nil {
+		return nil, s.linkError(err)
+	}
+
+	s.recordClick(ctx, req.GetShortId())
+
+	return &pb.GetOriginalResponse{OriginalUrl: originalURL}, nil
+}
+
+func (s *ShortenerServer) ListUserURLs(ctx context.Context, _ *pb.ListUserURLsRequest) (*pb.ListUserURLsResponse, error) {
+	userID, ok := auth.UserIDFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+
+	resp, err := s.service.GetUserURLs(ctx, userID)
+	if err != nil {
+		s.logger.Error("failed to get user URLs", zap.Error(err))
+		return nil, status.Error(codes.Internal, "Internal Server Error")
+	}
+
+	urls := make([]*pb.UserURL, len(resp))
+	for i := range resp {
+		urls[i] = &pb.UserURL{
+			ShortUrl:    resp[i].ShortURL,
+			OriginalUrl: resp[i].OriginalURL,
+		}
+	}
+
+	return &pb.ListUserURLsResponse{Urls: urls}, nil
+}
+
+func (s *ShortenerServer) DeleteUserURLs(ctx context.Context, req *pb.DeleteUserURLsRequest) (*pb.DeleteUserURLsResponse, error) {
+	userID, ok := auth.UserIDFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+
+	err := s.service.DeleteUserURLs(ctx, userID, req.GetShortIds())
+	if errors.Is(err, service.ErrEmptyShortIDBatch) {
+		return nil, status.Error(codes.InvalidArgument, "ShortID batch cannot be empty")
+	}
+
+	if errors.Is(err, service.ErrDeleteQueueFull) || errors.Is(err, service.ErrDeleterClosed) {
+		return nil, status.Error(codes.Unavailable, "Deletion is temporarily unavailable")
+	}
+
+	if err != nil {
+		s.logger.Error("failed to enqueue user URLs deletion", zap.Error(err))
+		return nil, status.Error(codes.Internal, "Internal Server Error")
+	}
+
+	return &pb.DeleteUserURLsResponse{}, nil
+}
+
+func (s *ShortenerServer) Ping(ctx context.Context, _ *pb.PingRequest) (*pb.PingResponse, error) {
+	if err := s.service.Ping(ctx); err != nil {
+		s.logger.Error("ping failed", zap.Error(err))
+		return nil, status.Error(codes.Unavailable, "Storage is unavailable")
+	}
+
+	return &pb.PingResponse{}, nil
+}
+
+// recordClick фиксирует переход, адрес клиента берется из соединения
+func (s *ShortenerServer) recordClick(ctx context.Context, shortID string) {
+	click := model.Click{ShortURL: shortID}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		click.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(click.IP); err == nil {
+			click.IP = host
+		}
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ua := md.Get("user-agent"); len(ua) > 0 {
+			click.UserAgent = ua[0]
+		}
+	}
+
+	s.service.RecordClick(click)
+}
+
+// shortenError переводит ошибки создания ссылок в статусы gRPC
+func (s *ShortenerServer) shortenError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrEmptyURL):
+		return status.Error(codes.InvalidArgument, "URL cannot be empty")
+	case errors.Is(err, service.ErrInvalidURL):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrDestinationBlocked):
+		return status.Error(codes.PermissionDenied, "Destination is blocked")
+	case errors.Is(err, service.ErrPrivateDestination):
+		return status.Error(codes.PermissionDenied, "Destination is in a private network")
+	case errors.Is(err, service.ErrEmptyURLBatch):
+		return status.Error(codes.InvalidArgument, "URL batch cannot be empty")
+	case errors.Is(err, service.ErrInvalidAlias):
+		return status.Error(codes.InvalidArgument, "Invalid custom alias")
+	case errors.Is(err, service.ErrTTLTooLong):
+		return status.Error(codes.InvalidArgument, "TTL is too long")
+	case errors.Is(err, service.ErrInvalidExpiry):
+		return status.Error(codes.InvalidArgument, "Expiry must be in the future")
+	case errors.Is(err, service.ErrInvalidMaxClicks):
+		return status.Error(codes.InvalidArgument, "Max clicks cannot be negative")
+	case errors.Is(err, service.ErrPasswordTooLong):
+		return status.Error(codes.InvalidArgument, "Password is too long")
+	case errors.Is(err, service.ErrAliasTaken):
+		return status.Error(codes.AlreadyExists, "Custom alias already taken")
+	default:
+		s.logger.Error("failed to shorten URL", zap.Error(err))
+		return status.Error(codes.Internal, "Internal Server Error")
+	}
+}
+
+// linkError переводит ошибки получения ссылки для перехода в статусы gRPC
+func (s *ShortenerServer) linkError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrEmptyShortID):
+		return status.Error(codes.InvalidArgument, "ShortID cannot be empty")
+	case errors.Is(err, service.ErrURLNotFound):
+		return status.Error(codes.NotFound, "URL not found")
+	case errors.Is(err, service.ErrURLDeleted):
+		return status.Error(codes.NotFound, "URL has been deleted")
+	case errors.Is(err, service.ErrURLExpired):
+		return status.Error(codes.NotFound, "URL has expired")
+	case errors.Is(err, service.ErrLinkExhausted):
+		return status.Error(codes.NotFound, "Link click limit exhausted")
+	case errors.Is(err, service.ErrDestinationBlocked):
+		return status.Error(codes.PermissionDenied, "Destination is blocked")
+	case errors.Is(err, service.ErrPasswordRequired):
+		return status.Error(codes.PermissionDenied, "Password required")
+	case errors.Is(err, service.ErrInvalidPassword):
+		return status.Error(codes.PermissionDenied, "Invalid password")
+	case errors.Is(err, service.ErrLinkLocked):
+		return status.Error(codes.ResourceExhausted, "Too many failed attempts, try again later")
+	default:
+		s.logger.Error("failed to get original URL", zap.Error(err))
+		return status.Error(codes.Internal, "Internal Server Error")
+	}
+}
+
+// timeFromProto возвращает nil для незаданной метки времени
+func timeFromProto(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
@@ -0,0 +1,266 @@
+package grpcserver_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/Gustik/shortener/internal/auth"
+	"github.com/Gustik/shortener/internal/grpcserver"
+	"github.com/Gustik/shortener/internal/repository"
+	"github.com/Gustik/shortener/internal/service"
+	"github.com/Gustik/shortener/internal/shortid"
+	"github.com/Gustik/shortener/internal/zaplog"
+	pb "github.com/Gustik/shortener/pkg/shortenerpb"
+)
+
+const (
+	baseURL   = "http://localhost:8080"
+	secretKey = "test-secret"
+)
+
+func newTestClient(t *testing.T) pb.ShortenerClient {
+	t.Helper()
+
+	repo := repository.NewInMemoryURLRepository()
+	deleter := service.NewURLDeleter(repo, zaplog.NewNoop())
+	clicks := service.NewClickRecorder(repo, zaplog.NewNoop())
+	t.Cleanup(func() {
+		deleter.Close()
+		clicks.Close()
+	})
+
+	svc := service.NewURLService(repo, deleter, clicks, shortid.NewRandom(shortid.Base62Alphabet, 8), service.NewURLValidator([]string{"http", "https"}, service.NormalizeOptions{}, nil, nil), baseURL, zaplog.NewNoop())
+	server := grpcserver.NewServer(grpcserver.NewShortenerServer(svc, zaplog.NewNoop()), secretKey)
+
+	lis := bufconn.Listen(1024 * 1024)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewShortenerClient(conn)
+}
+
+func withUser(userID string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), grpcserver.AuthMetadataKey, auth.Sign(userID, []byte(secretKey)))
+}
+
+func TestShortenerServer_Shorten(t *testing.T) {
+	client := newTestClient(t)
+
+	tests := []struct {
+		name          string
+		req           *pb.ShortenRequest
+		expectedCode  codes.Code
+		alreadyExists bool
+	}{
+		{
+			name:         "Успешное создание урла",
+			req:          &pb.ShortenRequest{Url: "https://ya.ru"},
+			expectedCode: codes.OK,
+		},
+		{
+			name:          "Повторное сокращение урла",
+			req:           &pb.ShortenRequest{Url: "https://ya.ru"},
+			expectedCode:  codes.OK,
+			alreadyExists: true,
+		},
+		{
+			name:         "Пустой урл",
+			req:          &pb.ShortenRequest{},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Свой алиас",
+			req:          &pb.ShortenRequest{Url: "https://practicum.yandex.ru", CustomAlias: "my-alias"},
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "Алиас занят",
+			req:          &pb.ShortenRequest{Url: "https://go.dev", CustomAlias: "my-alias"},
+			expectedCode: codes.AlreadyExists,
+		},
+		{
+			name:         "Отрицательный лимит переходов",
+			req:          &pb.ShortenRequest{Url: "https://go.dev", MaxClicks: -1},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Слишком большой ttl",
+			req:          &pb.ShortenRequest{Url: "https://go.dev", TtlSeconds: 18446744074},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Слишком длинный пароль",
+			req:          &pb.ShortenRequest{Url: "https://go.dev/long", Password: strings.Repeat("p", 100)},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Shorten(context.Background(), tt.req)
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+
+			if tt.expectedCode == codes.OK {
+				assert.True(t, strings.HasPrefix(resp.GetShortUrl(), baseURL))
+				assert.Equal(t, tt.alreadyExists, resp.GetAlreadyExists())
+			}
+		})
+	}
+}
+
+func TestShortenerServer_IssuesToken(t *testing.T) {
+	client := newTestClient(t)
+
+	var header metadata.MD
+	_, err := client.Shorten(context.Background(), &pb.ShortenRequest{Url: "https://ya.ru"}, grpc.Header(&header))
+	require.NoError(t, err)
+
+	tokens := header.Get(grpcserver.AuthMetadataKey)
+	require.Len(t, tokens, 1)
+
+	userID, err := auth.Verify(tokens[0], []byte(secretKey))
+	require.NoError(t, err)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), grpcserver.AuthMetadataKey, tokens[0])
+	resp, err := client.ListUserURLs(ctx, &pb.ListUserURLsRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.GetUrls(), 1, "ссылка должна принадлежать пользователю %s", userID)
+	assert.Equal(t, "https://ya.ru", resp.GetUrls()[0].GetOriginalUrl())
+}
+
+func TestShortenerServer_ShortenBatch(t *testing.T) {
+	client := newTestClient(t)
+
+	resp, err := client.ShortenBatch(context.Background(), &pb.ShortenBatchRequest{
+		Items: []*pb.BatchItem{
+			{CorrelationId: "1", OriginalUrl: "https://ya.ru"},
+			{CorrelationId: "2", OriginalUrl: "https://go.dev"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.GetItems(), 2)
+	assert.Equal(t, "1", resp.GetItems()[0].GetCorrelationId())
+	assert.Equal(t, "2", resp.GetItems()[1].GetCorrelationId())
+
+	_, err = client.ShortenBatch(context.Background(), &pb.ShortenBatchRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestShortenerServer_GetOriginal(t *testing.T) {
+	client := newTestClient(t)
+
+	plain, err := client.Shorten(context.Background(), &pb.ShortenRequest{Url: "https://ya.ru"})
+	require.NoError(t, err)
+
+	protected, err := client.Shorten(context.Background(), &pb.ShortenRequest{Url: "https://go.dev", Password: "secret"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		req          *pb.GetOriginalRequest
+		expectedCode codes.Code
+		expectedURL  string
+	}{
+		{
+			name:         "Успешный переход",
+			req:          &pb.GetOriginalRequest{ShortId: shortID(plain.GetShortUrl())},
+			expectedCode: codes.OK,
+			expectedURL:  "https://ya.ru",
+		},
+		{
+			name:         "Урл не найден",
+			req:          &pb.GetOriginalRequest{ShortId: "missing"},
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "Защищенная ссылка без пароля",
+			req:          &pb.GetOriginalRequest{ShortId: shortID(protected.GetShortUrl())},
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:         "Защищенная ссылка с неверным паролем",
+			req:          &pb.GetOriginalRequest{ShortId: shortID(protected.GetShortUrl()), Password: "wrong"},
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:         "Защищенная ссылка с паролем",
+			req:          &pb.GetOriginalRequest{ShortId: shortID(protected.GetShortUrl()), Password: "secret"},
+			expectedCode: codes.OK,
+			expectedURL:  "https://go.dev",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.GetOriginal(context.Background(), tt.req)
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			assert.Equal(t, tt.expectedURL, resp.GetOriginalUrl())
+		})
+	}
+}
+
+func TestShortenerServer_UserURLs(t *testing.T) {
+	client := newTestClient(t)
+
+	_, err := client.ListUserURLs(context.Background(), &pb.ListUserURLsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "без токена")
+
+	_, err = client.DeleteUserURLs(context.Background(), &pb.DeleteUserURLsRequest{ShortIds: []string{"abc"}})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "без токена")
+
+	ctx := withUser("user-1")
+	created, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "https://ya.ru"})
+	require.NoError(t, err)
+
+	list, err := client.ListUserURLs(ctx, &pb.ListUserURLsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetUrls(), 1)
+	assert.Equal(t, created.GetShortUrl(), list.GetUrls()[0].GetShortUrl())
+
+	other, err := client.ListUserURLs(withUser("user-2"), &pb.ListUserURLsRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, other.GetUrls())
+
+	_, err = client.DeleteUserURLs(ctx, &pb.DeleteUserURLsRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.DeleteUserURLs(ctx, &pb.DeleteUserURLsRequest{ShortIds: []string{shortID(created.GetShortUrl())}})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		_, err := client.GetOriginal(context.Background(), &pb.GetOriginalRequest{ShortId: shortID(created.GetShortUrl())})
+		return status.Code(err) == codes.NotFound
+	}, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestShortenerServer_Ping(t *testing.T) {
+	client := newTestClient(t)
+
+	_, err := client.Ping(context.Background(), &pb.PingRequest{})
+	assert.NoError(t, err)
+}
+
+func shortID(shortURL string) string {
+	return strings.TrimPrefix(shortURL, baseURL+"/")
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/Gustik/shortener/internal/model"
+)
+
+var linkInfoTemplate = template.Must(template.New("info").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Link info</title>
+</head>
+<body>
+<h1>{{.ShortURL}}</h1>
+<dl>
+{{if .PasswordProtected}}<dt>Destination</dt><dd>Hidden, this link is password protected</dd>
+{{else}}<dt>Destination</dt><dd><code>{{.OriginalURL}}</code></dd>
+{{end}}{{with .CreatedAt}}<dt>Created</dt><dd>{{.UTC.Format "2006-01-02 15:04 UTC"}}</dd>
+{{end}}{{with .ExpiresAt}}<dt>Expires</dt><dd>{{.UTC.Format "2006-01-02 15:04 UTC"}}</dd>
+{{end}}{{with .ClicksLeft}}<dt>Clicks left</dt><dd>{{.}}</dd>
+{{end}}<dt>Clicks</dt><dd>{{.Clicks}}</dd>
+</dl>
+<p><a href="{{.ShortURL}}" rel="nofollow noopener">Continue to the link</a></p>
+</body>
+</html>
+`))
+
+// GetURLInfo отдает страницу с информацией о ссылке без перехода по ней,
+// JSON при Accept: application/json
+func (h *URLHandler) GetURLInfo(w http.ResponseWriter, r *http.Request) {
+	shortID := chi.URLParam(r, "id")
+
+	info, err := h.service.GetURLInfo(r.Context(), shortID)
+	if err != nil {
+		h.writeLinkError(w, err)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(w).Encode(info); err != nil {
+			h.logger.Error("failed to encode response", zap.Error(err))
+		}
+		return
+	}
+
+	h.renderLinkInfo(w, info)
+}
+
+func (h *URLHandler) renderLinkInfo(w http.ResponseWriter, info *model.LinkInfoResponse) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	if err := linkInfoTemplate.Execute(w, info); err != nil {
+		h.logger.Error("failed to render link info", zap.Error(err))
+	}
+}
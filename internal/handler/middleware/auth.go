@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/Gustik/shortener/internal/auth"
+)
+
+const AuthCookieName = "user_id"
+
+// AuthMiddleware проверяет подписанную куку с идентификатором пользователя.
+// Если кука отсутствует или подпись не сходится, выдает новую.
+// По HTTPS кука выдается с флагом Secure, чтобы браузер не отправлял ее по открытому каналу.
+func AuthMiddleware(secret []byte, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, err := userIDFromCookie(r, secret)
+			if err == nil {
+				next.ServeHTTP(w, r.WithContext(auth.WithUserID(r.Context(), userID)))
+				return
+			}
+			logger.Debug("no valid auth cookie, issuing new one", zap.Error(err))
+
+			userID = auth.NewUserID()
+			http.SetCookie(w, &http.Cookie{
+				Name:     AuthCookieName,
+				Value:    auth.Sign(userID, secret),
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+			})
+
+			next.ServeHTTP(w, r.WithContext(auth.WithUserID(r.Context(), userID)))
+		})
+	}
+}
+
+// RequireAuthMiddleware пропускает только запросы с валидной кукой пользователя,
+// остальным отвечает 401
+func RequireAuthMiddleware(secret []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, err := userIDFromCookie(r, secret)
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithUserID(r.Context(), userID)))
+		})
+	}
+}
+
+func userIDFromCookie(r *http.Request, secret []byte) (string, error) {
+	cookie, err := r.Cookie(AuthCookieName)
+	if err != nil {
+		return "", err
+	}
+	return auth.Verify(cookie.Value, secret)
+}
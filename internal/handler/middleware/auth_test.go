@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Gustik/shortener/internal/auth"
+	"github.com/Gustik/shortener/internal/zaplog"
+)
+
+var testSecret = []byte("test-secret")
+
+// Тестовый handler, возвращающий идентификатор пользователя из контекста
+func userIDHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	w.Write([]byte(userID))
+}
+
+func findAuthCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == AuthCookieName {
+			return c
+		}
+	}
+	return nil
+}
+
+// Кука отсутствует, выдаем новую
+func TestAuthMiddleware_IssuesCookie(t *testing.T) {
+	handler := AuthMiddleware(testSecret, zaplog.NewNoop())(http.HandlerFunc(userIDHandler))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	cookie := findAuthCookie(rec)
+	require.NotNil(t, cookie, "Кука должна быть выдана")
+
+	userID, err := auth.Verify(cookie.Value, testSecret)
+	require.NoError(t, err, "Подпись выданной куки должна быть валидной")
+	assert.Equal(t, userID, rec.Body.String(), "В контексте должен быть тот же пользователь")
+}
+
+// По HTTPS кука выдается только для защищенного канала
+func TestAuthMiddleware_SecureCookieOverHTTPS(t *testing.T) {
+	handler := AuthMiddleware(testSecret, zaplog.NewNoop())(http.HandlerFunc(userIDHandler))
+
+	tests := []struct {
+		name       string
+		target     string
+		wantSecure bool
+	}{
+		{name: "HTTP", target: "http://localhost/", wantSecure: false},
+		{name: "HTTPS", target: "https://localhost/", wantSecure: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			cookie := findAuthCookie(rec)
+			require.NotNil(t, cookie, "Кука должна быть выдана")
+			assert.Equal(t, tt.wantSecure, cookie.Secure)
+		})
+	}
+}
+
+// Валидная кука, пользователь сохраняется, новая кука не выдается
+func TestAuthMiddleware_KeepsValidCookie(t *testing.T) {
+	handler := AuthMiddleware(testSecret, zaplog.NewNoop())(http.HandlerFunc(userIDHandler))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: auth.Sign("user-1", testSecret)})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Nil(t, findAuthCookie(rec), "Новая кука не должна выдаваться")
+	assert.Equal(t, "user-1", rec.Body.String())
+}
+
+// Подделанная кука, выдаем нового пользователя
+func TestAuthMiddleware_ReplacesTamperedCookie(t *testing.T) {
+	handler := AuthMiddleware(testSecret, zaplog.NewNoop())(http.HandlerFunc(userIDHandler))
+
+	tampered := auth.Sign("user-1", []byte("other-secret"))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: tampered})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	cookie := findAuthCookie(rec)
+	require.NotNil(t, cookie, "Должна быть выдана новая кука")
+	assert.NotEqual(t, "user-1", rec.Body.String(), "Пользователь из поддельной куки не должен приниматься")
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// TrustedSubnetMiddleware пропускает только запросы, у которых X-Real-IP входит в подсеть.
+// Пустая или некорректная подсеть запрещает доступ всем.
+func TrustedSubnetMiddleware(subnet string, logger *zap.Logger) func(http.Handler) http.Handler {
+	var ipNet *net.IPNet
+	if subnet != "" {
+		var err error
+		_, ipNet, err = net.ParseCIDR(subnet)
+		if err != nil {
+			logger.Error("invalid trusted subnet, access denied for everyone", zap.String("subnet", subnet), zap.Error(err))
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := net.ParseIP(r.Header.Get("X-Real-IP"))
+			if ipNet == nil || ip == nil || !ipNet.Contains(ip) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
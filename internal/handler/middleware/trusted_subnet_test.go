@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Gustik/shortener/internal/zaplog"
+)
+
+func TestTrustedSubnetMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		subnet       string
+		realIP       string
+		expectedCode int
+	}{
+		{
+			name:         "IP из доверенной подсети",
+			subnet:       "192.168.1.0/24",
+			realIP:       "192.168.1.10",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "IP вне подсети",
+			subnet:       "192.168.1.0/24",
+			realIP:       "10.0.0.1",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Нет заголовка X-Real-IP",
+			subnet:       "192.168.1.0/24",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Пустая подсеть запрещает всем",
+			subnet:       "",
+			realIP:       "192.168.1.10",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Некорректная подсеть запрещает всем",
+			subnet:       "not-a-cidr",
+			realIP:       "192.168.1.10",
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := TrustedSubnetMiddleware(tt.subnet, zaplog.NewNoop())(testHandler(http.StatusOK, "ok"))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+		})
+	}
+}
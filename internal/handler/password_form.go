@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+var passwordFormTemplate = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Protected link</title>
+</head>
+<body>
+<form method="post">
+<p>This link is password protected.</p>
+{{if .Error}}<p style="color: red">{{.Error}}</p>{{end}}
+<input type="password" name="password" autofocus required>
+<button type="submit">Open</button>
+</form>
+</body>
+</html>
+`))
+
+type passwordFormData struct {
+	Error string
+}
+
+// renderPasswordForm отдает форму ввода пароля для защищенной ссылки
+func (h *URLHandler) renderPasswordForm(w http.ResponseWriter, status int, errMsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+
+	if err := passwordFormTemplate.Execute(w, passwordFormData{Error: errMsg}); err != nil {
+		h.logger.Error("failed to render password form", zap.Error(err))
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/Gustik/shortener/internal/qr"
+)
+
+// qrCacheControl разрешает кешировать QR-код только браузеру и ненадолго,
+// чтобы удаленная или просроченная ссылка не продолжала отдаваться из общих кешей
+const qrCacheControl = "private, max-age=300"
+
+var qrContentTypes = map[string]string{
+	qr.FormatPNG: "image/png",
+	qr.FormatSVG: "image/svg+xml",
+}
+
+// GetQRCode отдает QR-код короткой ссылки.
+// Параметры запроса: format (png или svg), size в пикселях, margin в модулях и ecl (L, M, Q, H).
+func (h *URLHandler) GetQRCode(w http.ResponseWriter, r *http.Request) {
+	shortID := chi.URLParam(r, "id")
+
+	format, opts, err := parseQROptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	shortURL, err := h.service.GetShortURL(r.Context(), shortID)
+	if err != nil {
+		h.writeLinkError(w, err)
+		return
+	}
+
+	image, err := qr.Render(shortURL, format, opts)
+	if errors.Is(err, qr.ErrInvalidOptions) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		h.logger.Error("failed to render QR code", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", qrContentTypes[format])
+	w.Header().Set("Cache-Control", qrCacheControl)
+	w.WriteHeader(http.StatusOK)
+	w.Write(image)
+}
+
+// parseQROptions читает параметры QR-кода, отсутствующие берутся по умолчанию
+func parseQROptions(r *http.Request) (string, qr.Options, error) {
+	query := r.URL.Query()
+	opts := qr.DefaultOptions()
+
+	format := strings.ToLower(query.Get("format"))
+	if format == "" {
+		format = qr.FormatPNG
+	}
+	if _, ok := qrContentTypes[format]; !ok {
+		return "", opts, errors.New("format must be png or svg")
+	}
+
+	if value := query.Get("size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return "", opts, errors.New("size must be a number")
+		}
+		opts.Size = size
+	}
+
+	if value := query.Get("margin"); value != "" {
+		margin, err := strconv.Atoi(value)
+		if err != nil {
+			return "", opts, errors.New("margin must be a number")
+		}
+		opts.Margin = margin
+	}
+
+	if value := query.Get("ecl"); value != "" {
+		opts.Level = strings.ToUpper(value)
+	}
+
+	return format, opts, nil
+}
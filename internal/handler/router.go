@@ -9,7 +9,7 @@ import (
 	myMiddleware "github.com/Gustik/shortener/internal/handler/middleware"
 )
 
-func SetupRoutes(handler *URLHandler) http.Handler {
+func SetupRoutes(handler *URLHandler, secretKey, trustedSubnet string) http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(myMiddleware.RequestLogger(handler.logger))
@@ -17,11 +17,20 @@ func SetupRoutes(handler *URLHandler) http.Handler {
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	r.Use(myMiddleware.AuthMiddleware([]byte(secretKey), handler.logger))
 
 	r.With(myMiddleware.ContentTypeMiddleware("text/plain")).Post("/", handler.ShortenURL)
 	r.With(myMiddleware.ContentTypeMiddleware("application/json")).Post("/api/shorten", handler.ShortenURLV2)
 	r.With(myMiddleware.ContentTypeMiddleware("application/json")).Post("/api/shorten/batch", handler.ShortenURLBatch)
+	r.With(myMiddleware.RequireAuthMiddleware([]byte(secretKey))).Get("/api/user/urls", handler.GetUserURLs)
+	r.With(myMiddleware.RequireAuthMiddleware([]byte(secretKey)), myMiddleware.ContentTypeMiddleware("application/json")).Delete("/api/user/urls", handler.DeleteUserURLs)
+	r.With(myMiddleware.RequireAuthMiddleware([]byte(secretKey))).Get("/api/urls/{id}/stats", handler.GetURLStats)
+	r.With(myMiddleware.TrustedSubnetMiddleware(trustedSubnet, handler.logger)).Get("/api/internal/stats", handler.GetInternalStats)
+	// "+" не входит в алфавит идентификаторов, поэтому /{id}+ не пересекается с /{id}
+	r.Get("/{id}+", handler.GetURLInfo)
 	r.Get("/{id}", handler.GetOriginalURL)
+	r.Get("/{id}/qr", handler.GetQRCode)
+	r.Post("/{id}", handler.UnlockURL)
 	r.Get("/ping", handler.Ping)
 
 	return r
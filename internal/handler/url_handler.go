@@ -1,15 +1,19 @@
 package handler
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 
 	"go.uber.org/zap"
 
+	"github.com/Gustik/shortener/internal/auth"
 	"github.com/Gustik/shortener/internal/model"
+	"github.com/Gustik/shortener/internal/qr"
 	"github.com/Gustik/shortener/internal/service"
 	"github.com/go-chi/chi/v5"
 )
@@ -35,23 +39,22 @@ func (h *URLHandler) ShortenURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	shortURL, err := h.service.ShortenURL(r.Context(), strings.TrimSpace(string(body)))
-	if errors.Is(err, service.ErrEmptyURL) {
-		http.Error(w, "URL cannot be empty", http.StatusBadRequest)
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	shortURL, err := h.service.ShortenURL(r.Context(), strings.TrimSpace(string(body)), userID, service.ShortenOptions{})
+	if err != nil && !errors.Is(err, service.ErrURLExists) {
+		h.writeShortenError(w, err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "text/plain")
+
 	if errors.Is(err, service.ErrURLExists) {
 		w.WriteHeader(http.StatusConflict)
-	} else if err != nil {
-		h.logger.Error("failed to shorten URL", zap.Error(err))
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
 	} else {
 		w.WriteHeader(http.StatusCreated)
 	}
 
-	w.Header().Set("Content-Type", "text/plain")
 	w.Write([]byte(shortURL))
 }
 
@@ -64,9 +67,22 @@ func (h *URLHandler) ShortenURLV2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	shortURL, err := h.service.ShortenURL(r.Context(), req.URL)
-	if errors.Is(err, service.ErrEmptyURL) {
-		http.Error(w, "URL cannot be empty", http.StatusBadRequest)
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	// Секунды переводятся заранее, чтобы огромный ttl не переполнил time.Duration
+	var shortURL string
+	ttl, err := service.TTLFromSeconds(req.TTL)
+	if err == nil {
+		shortURL, err = h.service.ShortenURL(r.Context(), req.URL, userID, service.ShortenOptions{
+			CustomAlias: req.CustomAlias,
+			ExpiresAt:   req.ExpiresAt,
+			TTL:         ttl,
+			MaxClicks:   req.MaxClicks,
+			Password:    req.Password,
+		})
+	}
+	if err != nil && !errors.Is(err, service.ErrURLExists) {
+		h.writeShortenError(w, err)
 		return
 	}
 
@@ -74,10 +90,6 @@ func (h *URLHandler) ShortenURLV2(w http.ResponseWriter, r *http.Request) {
 
 	if errors.Is(err, service.ErrURLExists) {
 		w.WriteHeader(http.StatusConflict)
-	} else if err != nil {
-		h.logger.Error("failed to shorten URL", zap.Error(err))
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
 	} else {
 		w.WriteHeader(http.StatusCreated)
 	}
@@ -86,6 +98,15 @@ func (h *URLHandler) ShortenURLV2(w http.ResponseWriter, r *http.Request) {
 		Result: shortURL,
 	}
 
+	if req.QR {
+		png, err := qr.PNG(shortURL, qr.DefaultOptions())
+		if err != nil {
+			h.logger.Error("failed to render QR code", zap.Error(err))
+		} else {
+			resp.QR = "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+		}
+	}
+
 	if err := json.NewEncoder(w).Encode(&resp); err != nil {
 		h.logger.Error("failed to encode response", zap.Error(err))
 	}
@@ -100,43 +121,254 @@ func (h *URLHandler) ShortenURLBatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := h.service.ShortenURLBatch(r.Context(), req)
-	if errors.Is(err, service.ErrEmptyURLBatch) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	resp, err := h.service.ShortenURLBatch(r.Context(), req, userID)
+	if err != nil {
+		h.writeShortenError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	if err := json.NewEncoder(w).Encode(&resp); err != nil {
+		h.logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+func (h *URLHandler) GetOriginalURL(w http.ResponseWriter, r *http.Request) {
+	shortID := chi.URLParam(r, "id")
+
+	originalURL, err := h.service.GetOriginalURL(r.Context(), shortID)
+	if errors.Is(err, service.ErrPasswordRequired) {
+		h.renderPasswordForm(w, http.StatusOK, "")
+		return
+	}
+
+	if err != nil {
+		h.writeLinkError(w, err)
+		return
+	}
+
+	h.recordClick(r, shortID)
+
+	w.Header().Set("Location", originalURL)
+	w.WriteHeader(http.StatusTemporaryRedirect)
+}
+
+func (h *URLHandler) UnlockURL(w http.ResponseWriter, r *http.Request) {
+	shortID := chi.URLParam(r, "id")
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	originalURL, err := h.service.UnlockURL(r.Context(), shortID, r.PostFormValue("password"))
+	if errors.Is(err, service.ErrInvalidPassword) {
+		h.renderPasswordForm(w, http.StatusUnauthorized, "Invalid password")
+		return
+	}
+
+	if errors.Is(err, service.ErrLinkLocked) {
+		h.renderPasswordForm(w, http.StatusTooManyRequests, "Too many failed attempts, try again later")
+		return
+	}
+
+	if err != nil {
+		h.writeLinkError(w, err)
+		return
+	}
+
+	h.recordClick(r, shortID)
+
+	w.Header().Set("Location", originalURL)
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+// recordClick фиксирует переход, IP клиента уже выставлен middleware.RealIP
+func (h *URLHandler) recordClick(r *http.Request, shortID string) {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	h.service.RecordClick(model.Click{
+		ShortURL:  shortID,
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		IP:        ip,
+	})
+}
+
+// writeShortenError отвечает на ошибку создания ссылок.
+// ErrURLExists сюда не передается, на него отвечают сокращенной ранее ссылкой.
+func (h *URLHandler) writeShortenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrEmptyURL):
+		http.Error(w, "URL cannot be empty", http.StatusBadRequest)
+	case errors.Is(err, service.ErrInvalidURL):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrDestinationBlocked):
+		http.Error(w, "Destination is blocked", http.StatusForbidden)
+	case errors.Is(err, service.ErrPrivateDestination):
+		http.Error(w, "Destination is in a private network", http.StatusForbidden)
+	case errors.Is(err, service.ErrEmptyURLBatch):
 		http.Error(w, "URL batch cannot be empty", http.StatusBadRequest)
+	case errors.Is(err, service.ErrInvalidAlias):
+		http.Error(w, "Invalid custom alias", http.StatusBadRequest)
+	case errors.Is(err, service.ErrTTLTooLong):
+		http.Error(w, "TTL is too long", http.StatusBadRequest)
+	case errors.Is(err, service.ErrInvalidExpiry):
+		http.Error(w, "Expiry must be in the future", http.StatusBadRequest)
+	case errors.Is(err, service.ErrInvalidMaxClicks):
+		http.Error(w, "Max clicks cannot be negative", http.StatusBadRequest)
+	case errors.Is(err, service.ErrPasswordTooLong):
+		http.Error(w, "Password is too long", http.StatusBadRequest)
+	case errors.Is(err, service.ErrAliasTaken):
+		http.Error(w, "Custom alias already taken", http.StatusConflict)
+	default:
+		h.logger.Error("failed to shorten URL", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// writeLinkError отвечает на ошибку получения ссылки для перехода.
+// Пустой идентификатор (например, GET /+) означает несуществующую ссылку.
+func (h *URLHandler) writeLinkError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrURLNotFound), errors.Is(err, service.ErrEmptyShortID):
+		http.Error(w, "URL not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrURLDeleted):
+		http.Error(w, "URL has been deleted", http.StatusGone)
+	case errors.Is(err, service.ErrURLExpired):
+		http.Error(w, "URL has expired", http.StatusGone)
+	case errors.Is(err, service.ErrLinkExhausted):
+		http.Error(w, "Link click limit exhausted", http.StatusGone)
+	case errors.Is(err, service.ErrDestinationBlocked):
+		http.Error(w, "Destination is blocked", http.StatusUnavailableForLegalReasons)
+	default:
+		h.logger.Error("failed to get original URL", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+func (h *URLHandler) GetUserURLs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	resp, err := h.service.GetUserURLs(r.Context(), userID)
 	if err != nil {
-		h.logger.Error("failed to shorten URL batch", zap.Error(err))
+		h.logger.Error("failed to get user URLs", zap.Error(err))
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
+	if len(resp) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(http.StatusOK)
 
 	if err := json.NewEncoder(w).Encode(&resp); err != nil {
 		h.logger.Error("failed to encode response", zap.Error(err))
 	}
 }
 
-func (h *URLHandler) GetOriginalURL(w http.ResponseWriter, r *http.Request) {
+func (h *URLHandler) DeleteUserURLs(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var shortIDs []string
+	if err := json.NewDecoder(r.Body).Decode(&shortIDs); err != nil {
+		http.Error(w, "Failed to decode json", http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.DeleteUserURLs(r.Context(), userID, shortIDs)
+	if errors.Is(err, service.ErrEmptyShortIDBatch) {
+		http.Error(w, "ShortID batch cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, service.ErrDeleteQueueFull) || errors.Is(err, service.ErrDeleterClosed) {
+		http.Error(w, "Deletion is temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err != nil {
+		h.logger.Error("failed to enqueue user URLs deletion", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *URLHandler) GetURLStats(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	shortID := chi.URLParam(r, "id")
 
-	originalURL, err := h.service.GetOriginalURL(r.Context(), shortID)
+	resp, err := h.service.GetURLStats(r.Context(), userID, shortID, r.URL.Query().Get("granularity"))
+	if errors.Is(err, service.ErrInvalidGranularity) {
+		http.Error(w, "Granularity must be hour or day", http.StatusBadRequest)
+		return
+	}
+
 	if errors.Is(err, service.ErrURLNotFound) {
 		http.Error(w, "URL not found", http.StatusNotFound)
 		return
 	}
 
+	if errors.Is(err, service.ErrNotOwner) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	if err != nil {
-		h.logger.Error("failed to get original URL", zap.Error(err))
+		h.logger.Error("failed to get URL stats", zap.Error(err))
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Location", originalURL)
-	w.WriteHeader(http.StatusTemporaryRedirect)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+func (h *URLHandler) GetInternalStats(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.service.GetInternalStats(r.Context())
+	if err != nil {
+		h.logger.Error("failed to get internal stats", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Error("failed to encode response", zap.Error(err))
+	}
 }
 
 func (h *URLHandler) Ping(w http.ResponseWriter, r *http.Request) {
@@ -4,21 +4,77 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"image/png"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/Gustik/shortener/internal/auth"
 	"github.com/Gustik/shortener/internal/handler"
+	myMiddleware "github.com/Gustik/shortener/internal/handler/middleware"
 	"github.com/Gustik/shortener/internal/model"
 	"github.com/Gustik/shortener/internal/repository"
 	"github.com/Gustik/shortener/internal/service"
+	"github.com/Gustik/shortener/internal/shortid"
 	"github.com/Gustik/shortener/internal/zaplog"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-const baseURL = "http://localhost:8080"
+const (
+	baseURL   = "http://localhost:8080"
+	secretKey = "test-secret"
+)
+
+// testRouterOptions зависимости сервиса, которые тест хочет заменить. Нулевые значения - по умолчанию.
+type testRouterOptions struct {
+	ids           service.ShortIDGenerator
+	rules         *service.DestinationRules
+	network       *service.PrivateNetworkGuard
+	trustedSubnet string
+}
+
+// testRouter роутер вместе с фоновыми удалением и записью переходов сервиса.
+// Тест может закрыть их сам, чтобы дождаться фоновой записи.
+type testRouter struct {
+	http.Handler
+	deleter *service.URLDeleter
+	clicks  *service.ClickRecorder
+}
+
+// newTestRouter собирает сервис и роутер над repo, фоновые горутины закрываются в t.Cleanup
+func newTestRouter(t *testing.T, repo repository.URLRepository, opts testRouterOptions) *testRouter {
+	t.Helper()
+
+	if opts.ids == nil {
+		opts.ids = shortid.NewRandom(shortid.Base62Alphabet, 8)
+	}
+
+	deleter := service.NewURLDeleter(repo, zaplog.NewNoop())
+	clicks := service.NewClickRecorder(repo, zaplog.NewNoop())
+	t.Cleanup(func() {
+		deleter.Close()
+		clicks.Close()
+	})
+
+	urls := service.NewURLValidator([]string{"http", "https"}, service.NormalizeOptions{}, opts.rules, opts.network)
+	svc := service.NewURLService(repo, deleter, clicks, opts.ids, urls, baseURL, zaplog.NewNoop())
+
+	return &testRouter{
+		Handler: handler.SetupRoutes(handler.NewURLHandler(svc, zaplog.NewNoop()), secretKey, opts.trustedSubnet),
+		deleter: deleter,
+		clicks:  clicks,
+	}
+}
 
 func TestURLHandler_ShortenURL(t *testing.T) {
 	tests := []struct {
@@ -53,11 +109,74 @@ func TestURLHandler_ShortenURL(t *testing.T) {
 			expectedCode: http.StatusBadRequest,
 			expectedBody: "URL cannot be empty",
 		},
+		{
+			name:         "Не URL",
+			method:       http.MethodPost,
+			contentType:  "text/plain",
+			body:         "not a url",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "invalid URL",
+		},
+		{
+			name:         "Запрещенная схема",
+			method:       http.MethodPost,
+			contentType:  "text/plain",
+			body:         "javascript:alert(1)",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "URL scheme is not allowed",
+		},
+		{
+			name:         "URL без хоста",
+			method:       http.MethodPost,
+			contentType:  "text/plain",
+			body:         "https:///path",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "URL host is missing",
+		},
+		{
+			name:         "Тот же URL в другом регистре и с портом по умолчанию",
+			method:       http.MethodPost,
+			contentType:  "text/plain",
+			body:         "HTTPS://YA.RU:443",
+			expectedCode: http.StatusConflict,
+			expectedBody: baseURL,
+		},
+		{
+			name:         "Тот же URL с точкой в конце имени",
+			method:       http.MethodPost,
+			contentType:  "text/plain",
+			body:         "https://ya.ru.",
+			expectedCode: http.StatusConflict,
+			expectedBody: baseURL,
+		},
+		{
+			name:         "Хост из одной точки",
+			method:       http.MethodPost,
+			contentType:  "text/plain",
+			body:         "https://./path",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "URL host is missing",
+		},
+		{
+			name:         "Кириллический домен",
+			method:       http.MethodPost,
+			contentType:  "text/plain",
+			body:         "https://пример.рф/a",
+			expectedCode: http.StatusCreated,
+			expectedBody: baseURL,
+		},
+		{
+			name:         "Тот же домен в punycode",
+			method:       http.MethodPost,
+			contentType:  "text/plain",
+			body:         "https://xn--e1afmkfd.xn--p1ai/a",
+			expectedCode: http.StatusConflict,
+			expectedBody: baseURL,
+		},
 	}
 
 	repo := repository.NewInMemoryURLRepository()
-	service := service.NewURLService(repo, baseURL, zaplog.NewNoop())
-	router := handler.SetupRoutes(handler.NewURLHandler(service, zaplog.NewNoop()))
+	router := newTestRouter(t, repo, testRouterOptions{})
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -122,11 +241,42 @@ func TestURLHandler_ShortenURLV2(t *testing.T) {
 			expectedCode: http.StatusBadRequest,
 			expectedBody: "URL cannot be empty",
 		},
+		{
+			name:         "Свой alias",
+			method:       http.MethodPost,
+			contentType:  "application/json",
+			body:         `{"url": "https://shop.ru/sale", "custom_alias": "spring-sale"}`,
+			expectedCode: http.StatusCreated,
+			expectedBody: baseURL + "/spring-sale",
+		},
+		{
+			name:         "Занятый alias",
+			method:       http.MethodPost,
+			contentType:  "application/json",
+			body:         `{"url": "https://shop.ru/other", "custom_alias": "spring-sale"}`,
+			expectedCode: http.StatusConflict,
+			expectedBody: "Custom alias already taken",
+		},
+		{
+			name:         "Зарезервированный alias",
+			method:       http.MethodPost,
+			contentType:  "application/json",
+			body:         `{"url": "https://shop.ru/api", "custom_alias": "API"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid custom alias",
+		},
+		{
+			name:         "Недопустимые символы в alias",
+			method:       http.MethodPost,
+			contentType:  "application/json",
+			body:         `{"url": "https://shop.ru/bad", "custom_alias": "bad/alias"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid custom alias",
+		},
 	}
 
 	repo := repository.NewInMemoryURLRepository()
-	service := service.NewURLService(repo, baseURL, zaplog.NewNoop())
-	router := handler.SetupRoutes(handler.NewURLHandler(service, zaplog.NewNoop()))
+	router := newTestRouter(t, repo, testRouterOptions{})
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -163,6 +313,8 @@ func TestURLHandler_ShortenURLBatch(t *testing.T) {
 		expectedCode int
 		expectedBody string
 		checkResult  bool
+		// Для каждого элемента ответа: был ли URL сокращен раньше
+		expectedExisting []bool
 	}{
 		{
 			name:        "Успешное создание batch URLs",
@@ -173,8 +325,22 @@ func TestURLHandler_ShortenURLBatch(t *testing.T) {
 				{"correlation_id": "req-2", "original_url": "https://yandex.ru"},
 				{"correlation_id": "req-3", "original_url": "https://github.com"}
 			]`,
-			expectedCode: http.StatusCreated,
-			checkResult:  true,
+			expectedCode:     http.StatusCreated,
+			checkResult:      true,
+			expectedExisting: []bool{false, false, false},
+		},
+		{
+			name:        "Уже сокращенные URL в batch",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			body: `[
+				{"correlation_id": "req-1", "original_url": "https://yandex.ru"},
+				{"correlation_id": "req-2", "original_url": "https://batch.ru/new"},
+				{"correlation_id": "req-3", "original_url": "https://batch.ru/new"}
+			]`,
+			expectedCode:     http.StatusCreated,
+			checkResult:      true,
+			expectedExisting: []bool{true, false, false},
 		},
 		{
 			name:         "Неправильный content type",
@@ -192,6 +358,28 @@ func TestURLHandler_ShortenURLBatch(t *testing.T) {
 			expectedCode: http.StatusBadRequest,
 			expectedBody: "Failed to decode json",
 		},
+		{
+			name:        "Свой alias в batch",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			body: `[
+				{"correlation_id": "req-1", "original_url": "https://batch.ru/a", "custom_alias": "batch-a"},
+				{"correlation_id": "req-2", "original_url": "https://batch.ru/b"}
+			]`,
+			expectedCode: http.StatusCreated,
+			checkResult:  true,
+		},
+		{
+			name:        "Повторяющийся alias в batch",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			body: `[
+				{"correlation_id": "req-1", "original_url": "https://batch.ru/c", "custom_alias": "batch-c"},
+				{"correlation_id": "req-2", "original_url": "https://batch.ru/d", "custom_alias": "batch-c"}
+			]`,
+			expectedCode: http.StatusConflict,
+			expectedBody: "Custom alias already taken",
+		},
 		{
 			name:         "Пустой массив",
 			method:       http.MethodPost,
@@ -211,8 +399,7 @@ func TestURLHandler_ShortenURLBatch(t *testing.T) {
 	}
 
 	repo := repository.NewInMemoryURLRepository()
-	service := service.NewURLService(repo, baseURL, zaplog.NewNoop())
-	router := handler.SetupRoutes(handler.NewURLHandler(service, zaplog.NewNoop()))
+	router := newTestRouter(t, repo, testRouterOptions{})
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -241,7 +428,13 @@ func TestURLHandler_ShortenURLBatch(t *testing.T) {
 				for i, item := range resp {
 					assert.Equal(t, req[i].CorrelationID, item.CorrelationID, "CorrelationID должен совпадать")
 					assert.True(t, strings.HasPrefix(item.ShortURL, baseURL), "ShortURL должен начинаться с baseURL")
+					if req[i].CustomAlias != "" {
+						assert.Equal(t, baseURL+"/"+req[i].CustomAlias, item.ShortURL, "ShortURL должен использовать alias")
+					}
 					assert.NotEmpty(t, item.ShortURL, "ShortURL не должен быть пустым")
+					if tt.expectedExisting != nil {
+						assert.Equal(t, tt.expectedExisting[i], item.Existing, "Existing не совпадает для %s", item.CorrelationID)
+					}
 				}
 			} else if tt.expectedBody != "" {
 				assert.Contains(t, w.Body.String(), tt.expectedBody)
@@ -250,6 +443,51 @@ func TestURLHandler_ShortenURLBatch(t *testing.T) {
 	}
 }
 
+// stubGenerator выдает идентификаторы из списка по порядку
+type stubGenerator struct {
+	ids []string
+}
+
+func (g *stubGenerator) Generate(ctx context.Context, originalURL string, attempt int) (string, error) {
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id, nil
+}
+
+func TestURLHandler_ShortenURLBatchCollision(t *testing.T) {
+	repo := repository.NewInMemoryURLRepository()
+	repo.Save(context.Background(), model.URLRecord{ShortURL: "taken1", OriginalURL: "https://first.ru"})
+	repo.Save(context.Background(), model.URLRecord{ShortURL: "taken2", OriginalURL: "https://second.ru"})
+
+	// Первые два идентификатора уже заняты в хранилище, обе записи должны получить новые
+	ids := &stubGenerator{ids: []string{"taken1", "taken2", "fresh1", "fresh2"}}
+	router := newTestRouter(t, repo, testRouterOptions{ids: ids})
+
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", bytes.NewBufferString(`[
+		{"correlation_id": "req-1", "original_url": "https://new.ru/1"},
+		{"correlation_id": "req-2", "original_url": "https://new.ru/2"}
+	]`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var resp []model.BatchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp, 2)
+	assert.Equal(t, baseURL+"/fresh1", resp[0].ShortURL)
+	assert.Equal(t, baseURL+"/fresh2", resp[1].ShortURL)
+	assert.Empty(t, ids.ids, "Генератор должен быть вызван для каждой конфликтующей записи")
+
+	// Занятые ссылки остаются за своими URL
+	for shortURL, originalURL := range map[string]string{"taken1": "https://first.ru", "taken2": "https://second.ru"} {
+		record, err := repo.GetByShortURL(context.Background(), shortURL)
+		require.NoError(t, err)
+		assert.Equal(t, originalURL, record.OriginalURL)
+	}
+}
+
 func TestURLHandler_GetOriginalURL(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -278,13 +516,12 @@ func TestURLHandler_GetOriginalURL(t *testing.T) {
 	}
 
 	repo := repository.NewInMemoryURLRepository()
-	service := service.NewURLService(repo, baseURL, zaplog.NewNoop())
-	router := handler.SetupRoutes(handler.NewURLHandler(service, zaplog.NewNoop()))
+	router := newTestRouter(t, repo, testRouterOptions{})
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if tt.expectedCode == http.StatusTemporaryRedirect {
-				repo.Save(context.Background(), strings.TrimPrefix(tt.path, "/"), tt.url)
+				repo.Save(context.Background(), model.URLRecord{ShortURL: strings.TrimPrefix(tt.path, "/"), OriginalURL: tt.url})
 			}
 
 			r := httptest.NewRequest(tt.method, tt.path, nil)
@@ -302,3 +539,890 @@ func TestURLHandler_GetOriginalURL(t *testing.T) {
 		})
 	}
 }
+
+func TestURLHandler_GetUserURLs(t *testing.T) {
+	repo := repository.NewInMemoryURLRepository()
+	router := newTestRouter(t, repo, testRouterOptions{})
+
+	t.Run("Без куки возвращаем 401", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Поддельная кука возвращает 401", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		r.AddCookie(&http.Cookie{Name: myMiddleware.AuthCookieName, Value: auth.Sign("user-1", []byte("other"))})
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Нет ссылок возвращаем 204", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		r.AddCookie(&http.Cookie{Name: myMiddleware.AuthCookieName, Value: auth.Sign("empty-user", []byte(secretKey))})
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("Возвращаем только ссылки пользователя", func(t *testing.T) {
+		repo.Save(context.Background(), model.URLRecord{ShortURL: "user1url", OriginalURL: "https://ya.ru", UserID: "user-1"})
+		repo.Save(context.Background(), model.URLRecord{ShortURL: "user2url", OriginalURL: "https://github.com", UserID: "user-2"})
+
+		r := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		r.AddCookie(&http.Cookie{Name: myMiddleware.AuthCookieName, Value: auth.Sign("user-1", []byte(secretKey))})
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp []model.UserURLResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal("Не удалось декодировать ответ")
+		}
+
+		assert.Equal(t, []model.UserURLResponse{
+			{ShortURL: baseURL + "/user1url", OriginalURL: "https://ya.ru"},
+		}, resp)
+	})
+}
+
+func TestURLHandler_DeleteUserURLs(t *testing.T) {
+	repo := repository.NewInMemoryURLRepository()
+	router := newTestRouter(t, repo, testRouterOptions{})
+
+	repo.Save(context.Background(), model.URLRecord{ShortURL: "ownurl", OriginalURL: "https://ya.ru", UserID: "user-1"})
+	repo.Save(context.Background(), model.URLRecord{ShortURL: "otherurl", OriginalURL: "https://github.com", UserID: "user-2"})
+
+	deleteRequest := func(body, userID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodDelete, "/api/user/urls", bytes.NewBufferString(body))
+		r.Header.Set("Content-Type", "application/json")
+		if userID != "" {
+			r.AddCookie(&http.Cookie{Name: myMiddleware.AuthCookieName, Value: auth.Sign(userID, []byte(secretKey))})
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, deleteRequest(`["ownurl"]`, "").Code, "Без куки удалять нельзя")
+	assert.Equal(t, http.StatusBadRequest, deleteRequest("{invalid json", "user-1").Code)
+	assert.Equal(t, http.StatusBadRequest, deleteRequest(`[]`, "user-1").Code)
+	assert.Equal(t, http.StatusAccepted, deleteRequest(`["ownurl", "otherurl"]`, "user-1").Code)
+
+	// Дожидаемся фонового удаления
+	router.deleter.Close()
+
+	tests := []struct {
+		path         string
+		expectedCode int
+	}{
+		{path: "/ownurl", expectedCode: http.StatusGone},
+		{path: "/otherurl", expectedCode: http.StatusTemporaryRedirect},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, tt.expectedCode, w.Code, "Чужие ссылки не должны удаляться: %s", tt.path)
+	}
+}
+
+// blockingDeleteRepository задерживает удаление, пока тест не закроет release
+type blockingDeleteRepository struct {
+	*repository.InMemoryURLRepository
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingDeleteRepository) DeleteBatch(ctx context.Context, userID string, shortURLs []string) error {
+	select {
+	case r.started <- struct{}{}:
+	default:
+	}
+	<-r.release
+	return r.InMemoryURLRepository.DeleteBatch(ctx, userID, shortURLs)
+}
+
+func TestURLHandler_DeleteUserURLsQueueFull(t *testing.T) {
+	repo := &blockingDeleteRepository{
+		InMemoryURLRepository: repository.NewInMemoryURLRepository(),
+		started:               make(chan struct{}, 1),
+		release:               make(chan struct{}),
+	}
+	router := newTestRouter(t, repo, testRouterOptions{})
+
+	// Cleanup выполняются в обратном порядке: хранилище отпускается до закрытия удаления
+	t.Cleanup(func() { close(repo.release) })
+
+	// Пачка из 100 ссылок сразу уходит в хранилище и зависает там
+	shortIDs := make([]string, 100)
+	for i := range shortIDs {
+		shortIDs[i] = "id" + strconv.Itoa(i)
+	}
+	require.NoError(t, router.deleter.Enqueue("user-1", shortIDs))
+	<-repo.started
+
+	// Заполняем очередь, пока она не откажет
+	full := false
+	for range 10000 {
+		if err := router.deleter.Enqueue("user-1", []string{"more"}); err != nil {
+			require.ErrorIs(t, err, service.ErrDeleteQueueFull)
+			full = true
+			break
+		}
+	}
+	require.True(t, full, "Очередь должна быть ограничена")
+
+	r := httptest.NewRequest(http.MethodDelete, "/api/user/urls", bytes.NewBufferString(`["ownurl"]`))
+	r.Header.Set("Content-Type", "application/json")
+	r.AddCookie(&http.Cookie{Name: myMiddleware.AuthCookieName, Value: auth.Sign("user-1", []byte(secretKey))})
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		router.ServeHTTP(w, r)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	case <-time.After(time.Second):
+		t.Fatal("Запрос на удаление не должен ждать освобождения очереди")
+	}
+}
+
+func TestURLHandler_ExpiringURL(t *testing.T) {
+	repo := repository.NewInMemoryURLRepository()
+	router := newTestRouter(t, repo, testRouterOptions{})
+
+	past := time.Now().Add(-time.Hour)
+	repo.Save(context.Background(), model.URLRecord{ShortURL: "expired", OriginalURL: "https://ya.ru", ExpiresAt: &past})
+
+	shorten := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusCreated, shorten(`{"url": "https://ttl.ru", "ttl": 3600}`).Code)
+	assert.Equal(t, http.StatusBadRequest, shorten(`{"url": "https://past.ru", "expires_at": "2000-01-01T00:00:00Z"}`).Code,
+		"Срок в прошлом недопустим")
+	assert.Equal(t, http.StatusBadRequest, shorten(`{"url": "https://both.ru", "ttl": 60, "expires_at": "2999-01-01T00:00:00Z"}`).Code,
+		"ttl и expires_at взаимоисключающие")
+	assert.Equal(t, http.StatusBadRequest, shorten(`{"url": "https://negative.ru", "ttl": -60}`).Code)
+	assert.Equal(t, http.StatusBadRequest, shorten(`{"url": "https://huge.ru", "ttl": 18446744074}`).Code,
+		"Огромный ttl не должен переполнять срок жизни")
+
+	batch := httptest.NewRequest(http.MethodPost, "/api/shorten/batch",
+		bytes.NewBufferString(`[{"correlation_id": "1", "original_url": "https://huge.ru", "ttl": 18446744074}]`))
+	batch.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, batch)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	r := httptest.NewRequest(http.MethodGet, "/expired", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusGone, w.Code)
+
+	// Просроченная ссылка не мешает сократить тот же URL заново
+	w = shorten(`{"url": "https://ya.ru"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var resp model.Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.NotEqual(t, baseURL+"/expired", resp.Result)
+
+	r = httptest.NewRequest(http.MethodGet, strings.TrimPrefix(resp.Result, baseURL), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "https://ya.ru", w.Header().Get("Location"))
+
+	count, err := repo.DeleteExpired(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count, "Очистка должна пометить только просроченную ссылку")
+}
+
+func TestURLHandler_MaxClicks(t *testing.T) {
+	repo := repository.NewInMemoryURLRepository()
+	router := newTestRouter(t, repo, testRouterOptions{})
+
+	shorten := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, shorten(`{"url": "https://bad.ru", "max_clicks": -1}`).Code)
+	assert.Equal(t, http.StatusCreated, shorten(`{"url": "https://invite.ru", "custom_alias": "invite", "max_clicks": 2}`).Code)
+
+	expectedCodes := []int{http.StatusTemporaryRedirect, http.StatusTemporaryRedirect, http.StatusGone, http.StatusGone}
+	for i, expectedCode := range expectedCodes {
+		r := httptest.NewRequest(http.MethodGet, "/invite", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, expectedCode, w.Code, "Переход №%d", i+1)
+	}
+}
+
+func TestURLHandler_PasswordProtectedURL(t *testing.T) {
+	repo := repository.NewInMemoryURLRepository()
+	router := newTestRouter(t, repo, testRouterOptions{})
+
+	shorten := func(body string) {
+		r := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	unlock := func(path, password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader("password="+password))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	shorten(`{"url": "https://intranet.ru", "custom_alias": "secret", "password": "qwerty"}`)
+	shorten(`{"url": "https://intranet.ru/locked", "custom_alias": "locked", "password": "qwerty"}`)
+
+	t.Run("Слишком длинный пароль", func(t *testing.T) {
+		body := `{"url": "https://intranet.ru/long", "password": "` + strings.Repeat("p", 100) + `"}`
+		r := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Password is too long")
+	})
+
+	t.Run("Вместо редиректа отдаем форму", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/secret", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+		assert.Contains(t, w.Body.String(), `name="password"`)
+		assert.Empty(t, w.Header().Get("Location"))
+	})
+
+	t.Run("Неверный пароль", func(t *testing.T) {
+		w := unlock("/secret", "wrong")
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid password")
+	})
+
+	t.Run("Верный пароль", func(t *testing.T) {
+		w := unlock("/secret", "qwerty")
+
+		assert.Equal(t, http.StatusSeeOther, w.Code)
+		assert.Equal(t, "https://intranet.ru", w.Header().Get("Location"))
+	})
+
+	t.Run("Блокировка после серии ошибок", func(t *testing.T) {
+		for range 5 {
+			unlock("/locked", "wrong")
+		}
+
+		w := unlock("/locked", "qwerty")
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, "Даже верный пароль не принимается во время блокировки")
+	})
+}
+
+func TestURLHandler_RestrictedURLsNotDeduplicated(t *testing.T) {
+	repo := repository.NewInMemoryURLRepository()
+	router := newTestRouter(t, repo, testRouterOptions{})
+
+	shorten := func(body string) (int, string) {
+		r := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		var resp model.Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+		return w.Code, strings.TrimPrefix(resp.Result, baseURL)
+	}
+
+	code, public := shorten(`{"url": "https://pub.ru", "custom_alias": "pubby"}`)
+	require.Equal(t, http.StatusCreated, code)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "С паролем", body: `{"url": "https://pub.ru", "password": "secret"}`},
+		{name: "С лимитом переходов", body: `{"url": "https://pub.ru", "max_clicks": 1}`},
+		{name: "Со сроком жизни", body: `{"url": "https://pub.ru", "ttl": 3600}`},
+		{name: "С датой истечения", body: `{"url": "https://pub.ru", "expires_at": "2999-01-01T00:00:00Z"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, path := shorten(tt.body)
+
+			assert.Equal(t, http.StatusCreated, code, "Ссылка с ограничениями создается заново")
+			assert.NotEqual(t, public, path, "Нельзя отдавать ссылку без ограничений")
+		})
+	}
+
+	t.Run("Запрос без ограничений получает ссылку без ограничений", func(t *testing.T) {
+		code, path := shorten(`{"url": "https://pub.ru"}`)
+
+		assert.Equal(t, http.StatusConflict, code)
+		assert.Equal(t, public, path)
+	})
+
+	t.Run("Защищенная ссылка не выдается без пароля", func(t *testing.T) {
+		code, _ := shorten(`{"url": "https://private.ru", "password": "secret"}`)
+		require.Equal(t, http.StatusCreated, code)
+
+		code, path := shorten(`{"url": "https://private.ru"}`)
+		require.Equal(t, http.StatusCreated, code)
+
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	})
+
+	t.Run("Пачка", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", bytes.NewBufferString(`[
+			{"correlation_id": "1", "original_url": "https://pub.ru", "password": "secret"},
+			{"correlation_id": "2", "original_url": "https://pub.ru"}
+		]`))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var resp []model.BatchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Len(t, resp, 2)
+		assert.False(t, resp[0].Existing)
+		assert.NotEqual(t, baseURL+public, resp[0].ShortURL)
+		assert.True(t, resp[1].Existing)
+		assert.Equal(t, baseURL+public, resp[1].ShortURL)
+	})
+}
+
+func TestURLHandler_GetURLStats(t *testing.T) {
+	repo := repository.NewInMemoryURLRepository()
+	router := newTestRouter(t, repo, testRouterOptions{})
+
+	repo.Save(context.Background(), model.URLRecord{ShortURL: "stats", OriginalURL: "https://ya.ru", UserID: "user-1"})
+
+	visits := []struct {
+		ip        string
+		referrer  string
+		userAgent string
+	}{
+		{ip: "10.0.0.1", referrer: "https://t.me", userAgent: "Mozilla/5.0 Chrome/120.0 Safari/537.36"},
+		{ip: "10.0.0.1", referrer: "https://t.me", userAgent: "Mozilla/5.0 Chrome/120.0 Safari/537.36"},
+		{ip: "10.0.0.2", userAgent: "Mozilla/5.0 Firefox/121.0"},
+	}
+
+	for _, v := range visits {
+		r := httptest.NewRequest(http.MethodGet, "/stats", nil)
+		r.Header.Set("X-Real-IP", v.ip)
+		r.Header.Set("User-Agent", v.userAgent)
+		if v.referrer != "" {
+			r.Header.Set("Referer", v.referrer)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	}
+
+	// Дожидаемся сохранения переходов
+	router.clicks.Close()
+
+	statsRequest := func(path, userID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if userID != "" {
+			r.AddCookie(&http.Cookie{Name: myMiddleware.AuthCookieName, Value: auth.Sign(userID, []byte(secretKey))})
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, statsRequest("/api/urls/stats/stats", "").Code)
+	assert.Equal(t, http.StatusForbidden, statsRequest("/api/urls/stats/stats", "user-2").Code)
+	assert.Equal(t, http.StatusNotFound, statsRequest("/api/urls/missing/stats", "user-1").Code)
+	assert.Equal(t, http.StatusBadRequest, statsRequest("/api/urls/stats/stats?granularity=week", "user-1").Code)
+
+	w := statsRequest("/api/urls/stats/stats?granularity=hour", "user-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp model.LinkStatsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal("Не удалось декодировать ответ")
+	}
+
+	assert.Equal(t, int64(3), resp.TotalClicks)
+	assert.Equal(t, int64(2), resp.UniqueVisitors)
+	assert.NotNil(t, resp.FirstClick)
+	assert.NotNil(t, resp.LastClick)
+	assert.Equal(t, "hour", resp.Granularity)
+	if assert.Len(t, resp.Buckets, 1) {
+		assert.Equal(t, int64(3), resp.Buckets[0].Count)
+	}
+	assert.Equal(t, []model.StatsEntry{{Name: "https://t.me", Count: 2}, {Name: "(direct)", Count: 1}}, resp.TopReferrers)
+	assert.Equal(t, []model.StatsEntry{{Name: "Chrome", Count: 2}, {Name: "Firefox", Count: 1}}, resp.TopUserAgents)
+}
+
+func TestURLHandler_GetInternalStats(t *testing.T) {
+	repo := repository.NewInMemoryURLRepository()
+	router := newTestRouter(t, repo, testRouterOptions{trustedSubnet: "10.0.0.0/8"})
+
+	repo.Save(context.Background(), model.URLRecord{ShortURL: "first", OriginalURL: "https://ya.ru", UserID: "user-1"})
+	repo.Save(context.Background(), model.URLRecord{ShortURL: "second", OriginalURL: "https://github.com", UserID: "user-1"})
+	repo.Save(context.Background(), model.URLRecord{ShortURL: "third", OriginalURL: "https://go.dev", UserID: "user-2"})
+
+	r := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+	r.Header.Set("X-Real-IP", "192.168.0.1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusForbidden, w.Code, "Запрос не из доверенной подсети")
+
+	r = httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+	r.Header.Set("X-Real-IP", "10.1.2.3")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"urls": 3, "users": 2}`, w.Body.String())
+}
+
+func TestURLHandler_DestinationRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# фишинг\nblock evil.ru\nblock ~/login\\.php$\n"), 0o644))
+
+	rules, err := service.NewDestinationRules(path)
+	require.NoError(t, err)
+
+	repo := repository.NewInMemoryURLRepository()
+	router := newTestRouter(t, repo, testRouterOptions{rules: rules})
+
+	shorten := func(url string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url))
+		r.Header.Set("Content-Type", "text/plain")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	redirect := func(shortURL string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, strings.TrimPrefix(shortURL, baseURL), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name         string
+		url          string
+		expectedCode int
+	}{
+		{name: "Заблокированный домен", url: "https://evil.ru/pay", expectedCode: http.StatusForbidden},
+		{name: "Поддомен заблокированного домена", url: "https://login.Evil.ru", expectedCode: http.StatusForbidden},
+		{name: "Точка в конце имени", url: "https://evil.ru./x", expectedCode: http.StatusForbidden},
+		{name: "Поддомен с точкой в конце имени", url: "https://login.evil.ru../x", expectedCode: http.StatusForbidden},
+		{name: "Регулярное выражение", url: "https://bank.example/login.php", expectedCode: http.StatusForbidden},
+		{name: "Похожий, но другой домен", url: "https://notevil.ru", expectedCode: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedCode, shorten(tt.url).Code)
+		})
+	}
+
+	t.Run("Сохраненная ранее ссылка с точкой в конце имени", func(t *testing.T) {
+		repo.Save(context.Background(), model.URLRecord{ShortURL: "legacy", OriginalURL: "https://evil.ru./old"})
+
+		assert.Equal(t, http.StatusUnavailableForLegalReasons, redirect("/legacy").Code)
+	})
+
+	t.Run("Блокировка после перечитывания правил", func(t *testing.T) {
+		w := shorten("https://ya.ru")
+		require.Equal(t, http.StatusCreated, w.Code)
+		shortURL := w.Body.String()
+
+		assert.Equal(t, http.StatusTemporaryRedirect, redirect(shortURL).Code)
+
+		require.NoError(t, os.WriteFile(path, []byte("block ya.ru\n"), 0o644))
+		require.NoError(t, rules.Reload())
+
+		assert.Equal(t, http.StatusUnavailableForLegalReasons, redirect(shortURL).Code)
+	})
+
+	t.Run("Только разрешенные домены", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("allow go.dev\n"), 0o644))
+		require.NoError(t, rules.Reload())
+
+		assert.Equal(t, http.StatusCreated, shorten("https://pkg.go.dev/net/url").Code)
+		assert.Equal(t, http.StatusForbidden, shorten("https://github.com").Code)
+	})
+
+	t.Run("Ошибка в файле не сбрасывает правила", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("deny go.dev\n"), 0o644))
+		assert.Error(t, rules.Reload())
+
+		assert.Equal(t, http.StatusForbidden, shorten("https://gitlab.com").Code)
+	})
+}
+
+// fakeResolver отвечает заранее заданными адресами вместо DNS
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	addrs := make([]netip.Addr, len(ips))
+	for i, ip := range ips {
+		addrs[i] = netip.MustParseAddr(ip)
+	}
+	return addrs, nil
+}
+
+func TestURLHandler_PrivateNetworks(t *testing.T) {
+	resolver := fakeResolver{
+		"public.example":   {"93.184.216.34"},
+		"localhost":        {"127.0.0.1", "::1"},
+		"rebind.example":   {"93.184.216.34", "10.0.0.5"},
+		"intranet.example": {"10.1.2.3"},
+	}
+
+	network, err := service.NewPrivateNetworkGuard(resolver, []string{"10.1.0.0/16"})
+	require.NoError(t, err)
+
+	repo := repository.NewInMemoryURLRepository()
+	router := newTestRouter(t, repo, testRouterOptions{network: network})
+
+	tests := []struct {
+		name         string
+		url          string
+		expectedCode int
+	}{
+		{name: "Публичный адрес", url: "https://public.example", expectedCode: http.StatusCreated},
+		{name: "Loopback по имени", url: "http://localhost:8080/admin", expectedCode: http.StatusForbidden},
+		{name: "Loopback по адресу", url: "http://127.0.0.1/", expectedCode: http.StatusForbidden},
+		{name: "Metadata облака", url: "http://169.254.169.254/latest/meta-data", expectedCode: http.StatusForbidden},
+		{name: "RFC 1918 в IPv6-записи", url: "http://[::ffff:192.168.0.1]/", expectedCode: http.StatusForbidden},
+		{name: "Один из адресов внутренний", url: "https://rebind.example", expectedCode: http.StatusForbidden},
+		{name: "Разрешенная внутренняя подсеть", url: "https://intranet.example/wiki", expectedCode: http.StatusCreated},
+		{name: "Хост не разрешается", url: "https://missing.example", expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.url))
+			r.Header.Set("Content-Type", "text/plain")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.expectedCode, w.Code, w.Body.String())
+		})
+	}
+}
+
+// countingResolver считает обращения к каждому хосту, пачка разрешает хосты параллельно
+type countingResolver struct {
+	fakeResolver
+	mu      sync.Mutex
+	lookups map[string]int
+}
+
+func (r *countingResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	r.mu.Lock()
+	r.lookups[host]++
+	r.mu.Unlock()
+
+	return r.fakeResolver.LookupNetIP(ctx, network, host)
+}
+
+func TestURLHandler_PrivateNetworksBatch(t *testing.T) {
+	resolver := &countingResolver{
+		fakeResolver: fakeResolver{
+			"public.example": {"93.184.216.34"},
+			"docs.example":   {"93.184.216.35"},
+			"localhost":      {"127.0.0.1"},
+		},
+		lookups: make(map[string]int),
+	}
+
+	network, err := service.NewPrivateNetworkGuard(resolver, nil)
+	require.NoError(t, err)
+
+	repo := repository.NewInMemoryURLRepository()
+	router := newTestRouter(t, repo, testRouterOptions{network: network})
+
+	shortenBatch := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("Каждый хост разрешается один раз", func(t *testing.T) {
+		w := shortenBatch(`[
+			{"correlation_id": "1", "original_url": "https://public.example/a"},
+			{"correlation_id": "2", "original_url": "https://public.example/b"},
+			{"correlation_id": "3", "original_url": "https://docs.example/a"},
+			{"correlation_id": "4", "original_url": "https://public.example/c"}
+		]`)
+
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		assert.Equal(t, map[string]int{"public.example": 1, "docs.example": 1}, resolver.lookups)
+	})
+
+	t.Run("Внутренний адрес в пачке", func(t *testing.T) {
+		w := shortenBatch(`[
+			{"correlation_id": "1", "original_url": "https://public.example/d"},
+			{"correlation_id": "2", "original_url": "http://localhost/admin"}
+		]`)
+
+		assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+		// Пачка отклонена целиком, остались только ссылки из предыдущего запроса
+		count, err := repo.CountURLs(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 4, count)
+	})
+}
+
+func TestURLHandler_GetQRCode(t *testing.T) {
+	repo := repository.NewInMemoryURLRepository()
+	router := newTestRouter(t, repo, testRouterOptions{})
+
+	repo.Save(context.Background(), model.URLRecord{ShortURL: "print", OriginalURL: "https://ya.ru"})
+	repo.Save(context.Background(), model.URLRecord{ShortURL: "gone", OriginalURL: "https://go.dev", IsDeleted: true})
+	past := time.Now().Add(-time.Hour)
+	repo.Save(context.Background(), model.URLRecord{ShortURL: "old", OriginalURL: "https://github.com", ExpiresAt: &past})
+
+	tests := []struct {
+		name                string
+		path                string
+		expectedCode        int
+		expectedContentType string
+		expectedSize        int
+	}{
+		{
+			name:                "PNG по умолчанию",
+			path:                "/print/qr",
+			expectedCode:        http.StatusOK,
+			expectedContentType: "image/png",
+			expectedSize:        256,
+		},
+		{
+			name:                "PNG с параметрами",
+			path:                "/print/qr?size=512&margin=0&ecl=h",
+			expectedCode:        http.StatusOK,
+			expectedContentType: "image/png",
+			expectedSize:        512,
+		},
+		{
+			name:                "SVG",
+			path:                "/print/qr?format=svg",
+			expectedCode:        http.StatusOK,
+			expectedContentType: "image/svg+xml",
+		},
+		{
+			name:         "Неизвестный формат",
+			path:         "/print/qr?format=gif",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Размер не число",
+			path:         "/print/qr?size=big",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Размер меньше числа модулей",
+			path:         "/print/qr?size=10",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Отрицательная рамка",
+			path:         "/print/qr?margin=-1",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Неизвестный уровень коррекции",
+			path:         "/print/qr?ecl=X",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Ссылка не найдена",
+			path:         "/missing/qr",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Ссылка удалена",
+			path:         "/gone/qr",
+			expectedCode: http.StatusGone,
+		},
+		{
+			name:         "Срок ссылки истек",
+			path:         "/old/qr",
+			expectedCode: http.StatusGone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.expectedCode, w.Code, w.Body.String())
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, tt.expectedContentType, w.Header().Get("Content-Type"))
+			assert.True(t, strings.HasPrefix(w.Header().Get("Cache-Control"), "private"), "QR-код не должен попадать в общие кеши")
+
+			if tt.expectedContentType == "image/png" {
+				img, err := png.Decode(w.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedSize, img.Bounds().Dx())
+				assert.Equal(t, tt.expectedSize, img.Bounds().Dy())
+			} else {
+				assert.True(t, strings.HasPrefix(w.Body.String(), "<svg"))
+			}
+		})
+	}
+}
+
+func TestURLHandler_ShortenURLV2WithQR(t *testing.T) {
+	repo := repository.NewInMemoryURLRepository()
+	router := newTestRouter(t, repo, testRouterOptions{})
+
+	shorten := func(body string) model.Response {
+		r := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		var resp model.Response
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	withQR := shorten(`{"url": "https://ya.ru", "qr": true}`)
+	assert.True(t, strings.HasPrefix(withQR.QR, "data:image/png;base64,"))
+
+	withoutQR := shorten(`{"url": "https://go.dev"}`)
+	assert.Empty(t, withoutQR.QR)
+}
+
+func TestURLHandler_GetURLInfo(t *testing.T) {
+	repo := repository.NewInMemoryURLRepository()
+	router := newTestRouter(t, repo, testRouterOptions{})
+
+	clicksLeft := int64(5)
+	repo.Save(context.Background(), model.URLRecord{ShortURL: "info", OriginalURL: "https://ya.ru/?q=<b>", UserID: "user-1", ClicksLeft: &clicksLeft})
+	repo.Save(context.Background(), model.URLRecord{ShortURL: "secret", OriginalURL: "https://intranet.ru", PasswordHash: "hash"})
+	repo.Save(context.Background(), model.URLRecord{ShortURL: "gone", OriginalURL: "https://go.dev", IsDeleted: true})
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusTemporaryRedirect, get("/info", "").Code)
+	// Дожидаемся сохранения перехода
+	router.clicks.Close()
+
+	t.Run("JSON", func(t *testing.T) {
+		w := get("/info+", "application/json")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var info model.LinkInfoResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&info))
+
+		assert.Equal(t, baseURL+"/info", info.ShortURL)
+		assert.Equal(t, "https://ya.ru/?q=<b>", info.OriginalURL)
+		assert.False(t, info.PasswordProtected)
+		assert.NotNil(t, info.CreatedAt)
+		assert.Equal(t, int64(1), info.Clicks)
+		if assert.NotNil(t, info.ClicksLeft) {
+			assert.Equal(t, int64(4), *info.ClicksLeft, "Страница информации не списывает переход")
+		}
+		assert.NotContains(t, w.Body.String(), "user-1")
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+		w := get("/info+", "text/html")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "https://ya.ru/?q=&lt;b&gt;")
+		assert.Empty(t, w.Header().Get("Location"))
+	})
+
+	t.Run("Защищенная ссылка не раскрывает адрес", func(t *testing.T) {
+		w := get("/secret+", "application/json")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "intranet.ru")
+		assert.Contains(t, w.Body.String(), `"password_protected":true`)
+	})
+
+	t.Run("Удаленная ссылка", func(t *testing.T) {
+		assert.Equal(t, http.StatusGone, get("/gone+", "").Code)
+	})
+
+	t.Run("Ссылка не найдена", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get("/missing+", "").Code)
+	})
+
+	t.Run("Пустой идентификатор", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get("/+", "").Code)
+	})
+}
@@ -1,29 +1,137 @@
 package model
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type Request struct {
-	URL string `json:"url"`
+	URL         string     `json:"url"`
+	CustomAlias string     `json:"custom_alias,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	TTL         int64      `json:"ttl,omitempty"` // время жизни в секундах
+	MaxClicks   int64      `json:"max_clicks,omitempty"`
+	Password    string     `json:"password,omitempty"`
+	// QR добавляет в ответ QR-код ссылки
+	QR bool `json:"qr,omitempty"`
 }
 
 type Response struct {
 	Result string `json:"result"`
+	// QR PNG с QR-кодом ссылки в виде data URI
+	QR string `json:"qr,omitempty"`
 }
 
 type BatchRequest struct {
-	CorrelationID string `json:"correlation_id"`
-	OriginalURL   string `json:"original_url"`
+	CorrelationID string     `json:"correlation_id"`
+	OriginalURL   string     `json:"original_url"`
+	CustomAlias   string     `json:"custom_alias,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	TTL           int64      `json:"ttl,omitempty"` // время жизни в секундах
+	MaxClicks     int64      `json:"max_clicks,omitempty"`
+	Password      string     `json:"password,omitempty"`
 }
 
 type BatchResponse struct {
 	CorrelationID string `json:"correlation_id"`
 	ShortURL      string `json:"short_url"`
+	// Existing true, если такой URL был сокращен раньше, а не создан этим запросом
+	Existing bool `json:"existing"`
+}
+
+type UserURLResponse struct {
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+}
+
+type InternalStatsResponse struct {
+	URLs  int `json:"urls"`
+	Users int `json:"users"`
 }
 
 type URLRecord struct {
-	UUID        uuid.UUID `json:"uuid"`
-	ShortURL    string    `json:"short_url"`
-	OriginalURL string    `json:"original_url"`
+	UUID         uuid.UUID  `json:"uuid"`
+	ShortURL     string     `json:"short_url"`
+	OriginalURL  string     `json:"original_url"`
+	UserID       string     `json:"user_id,omitempty"`
+	IsDeleted    bool       `json:"is_deleted,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	ClicksLeft   *int64     `json:"clicks_left,omitempty"` // nil для ссылок без ограничения переходов
+	PasswordHash string     `json:"password_hash,omitempty"`
+	// CreatedAt nil у записей, сохраненных до появления поля
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// Click событие перехода по короткой ссылке
+type Click struct {
+	ShortURL  string    `json:"short_url"`
+	ClickedAt time.Time `json:"clicked_at"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+}
+
+// Шаг группировки переходов во времени
+const (
+	GranularityHour = "hour"
+	GranularityDay  = "day"
+)
+
+// ClickAggregate сырые агрегаты переходов по ссылке, которые считает репозиторий
+type ClickAggregate struct {
+	Total      int64
+	Unique     int64
+	FirstClick *time.Time
+	LastClick  *time.Time
+	Buckets    []StatsBucket
+	Referrers  map[string]int64
+	UserAgents map[string]int64
+}
+
+type StatsBucket struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
+
+type StatsEntry struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// LinkInfoResponse публичные сведения о ссылке без данных владельца.
+// OriginalURL не раскрывается для ссылок с паролем.
+type LinkInfoResponse struct {
+	ShortURL          string     `json:"short_url"`
+	OriginalURL       string     `json:"original_url,omitempty"`
+	PasswordProtected bool       `json:"password_protected"`
+	CreatedAt         *time.Time `json:"created_at,omitempty"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	ClicksLeft        *int64     `json:"clicks_left,omitempty"`
+	Clicks            int64      `json:"clicks"`
+}
+
+type LinkStatsResponse struct {
+	ShortURL       string        `json:"short_url"`
+	TotalClicks    int64         `json:"total_clicks"`
+	UniqueVisitors int64         `json:"unique_visitors"`
+	FirstClick     *time.Time    `json:"first_click,omitempty"`
+	LastClick      *time.Time    `json:"last_click,omitempty"`
+	Granularity    string        `json:"granularity"`
+	Buckets        []StatsBucket `json:"buckets"`
+	TopReferrers   []StatsEntry  `json:"top_referrers"`
+	TopUserAgents  []StatsEntry  `json:"top_user_agents"`
+}
+
+// IsExpired сообщает, истек ли срок жизни ссылки к моменту now
+func (u *URLRecord) IsExpired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
+}
+
+// IsRestricted сообщает, защищена ли ссылка паролем, ограничением переходов или сроком жизни.
+// Такие ссылки не объединяются с другими по original_url: каждая создается отдельно.
+func (u *URLRecord) IsRestricted() bool {
+	return u.PasswordHash != "" || u.ClicksLeft != nil || u.ExpiresAt != nil
 }
 
 func (u *URLRecord) NextID() {
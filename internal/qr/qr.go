@@ -0,0 +1,167 @@
+// Package qr рисует QR-коды коротких ссылок в PNG и SVG.
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+
+	MaxSize   = 4096
+	MaxMargin = 64
+)
+
+var ErrInvalidOptions = errors.New("invalid QR code options")
+
+// levels уровни коррекции ошибок в обозначениях стандарта
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// Options параметры изображения
+type Options struct {
+	// Size сторона изображения в пикселях
+	Size int
+	// Margin ширина белой рамки в модулях, стандарт рекомендует 4
+	Margin int
+	// Level уровень коррекции ошибок: L, M, Q или H
+	Level string
+}
+
+func DefaultOptions() Options {
+	return Options{Size: 256, Margin: 4, Level: "M"}
+}
+
+func (o Options) validate() error {
+	if o.Size < 1 || o.Size > MaxSize {
+		return fmt.Errorf("%w: size must be between 1 and %d", ErrInvalidOptions, MaxSize)
+	}
+
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return fmt.Errorf("%w: margin must be between 0 and %d", ErrInvalidOptions, MaxMargin)
+	}
+
+	if _, ok := levels[strings.ToUpper(o.Level)]; !ok {
+		return fmt.Errorf("%w: level must be one of L, M, Q, H", ErrInvalidOptions)
+	}
+
+	return nil
+}
+
+// Render рисует QR-код content в формате FormatPNG или FormatSVG
+func Render(content, format string, opts Options) ([]byte, error) {
+	switch format {
+	case FormatPNG:
+		return PNG(content, opts)
+	case FormatSVG:
+		return SVG(content, opts)
+	default:
+		return nil, fmt.Errorf("%w: format must be png or svg", ErrInvalidOptions)
+	}
+}
+
+// PNG рисует QR-код размером ровно Size пикселей, модули выравниваются по центру
+func PNG(content string, opts Options) ([]byte, error) {
+	modules, err := encode(content, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	scale := opts.Size / len(modules)
+	if scale < 1 {
+		return nil, fmt.Errorf("%w: size must be at least %d for this link", ErrInvalidOptions, len(modules))
+	}
+	offset := (opts.Size - scale*len(modules)) / 2
+
+	img := image.NewPaletted(image.Rect(0, 0, opts.Size, opts.Size), color.Palette{color.White, color.Black})
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := range scale {
+				for dx := range scale {
+					img.SetColorIndex(offset+x*scale+dx, offset+y*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encode png: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// SVG рисует QR-код в координатах модулей, Size задает размер на странице
+func SVG(content string, opts Options) ([]byte, error) {
+	modules, err := encode(content, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(modules)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, opts.Size, opts.Size, n, n)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+
+	// Соседние темные модули строки объединяем в один прямоугольник
+	for y, row := range modules {
+		for x := 0; x < n; x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < n && row[x] {
+				x++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+
+	buf.WriteString(`"/></svg>`)
+
+	return buf.Bytes(), nil
+}
+
+// encode возвращает матрицу модулей вместе с рамкой
+func encode(content string, opts Options) ([][]bool, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	code, err := qrcode.New(content, levels[strings.ToUpper(opts.Level)])
+	if err != nil {
+		return nil, fmt.Errorf("encode qr: %w", err)
+	}
+	code.DisableBorder = true
+
+	bitmap := code.Bitmap()
+	n := len(bitmap) + 2*opts.Margin
+
+	modules := make([][]bool, n)
+	for y := range modules {
+		modules[y] = make([]bool, n)
+	}
+	for y, row := range bitmap {
+		copy(modules[y+opts.Margin][opts.Margin:], row)
+	}
+
+	return modules, nil
+}
@@ -8,6 +8,12 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
 
 	"github.com/Gustik/shortener/internal/model"
 )
@@ -16,13 +22,25 @@ type FileURLRepository struct {
 	InMemoryURLRepository
 	file   *os.File
 	writer *bufio.Writer
+
+	// Переходы пишутся в отдельный журнал, чтобы не раздувать файл ссылок
+	clicksFileMu sync.Mutex
+	clicksFile   *os.File
+	clicksWriter *bufio.Writer
+
+	// Текущее значение счетчика short_url хранится в отдельном файле и переписывается целиком
+	counterMu   sync.Mutex
+	counterFile *os.File
 }
 
-func NewFileURLRepository(file *os.File) (*FileURLRepository, error) {
+func NewFileURLRepository(file, clicksFile, counterFile *os.File) (*FileURLRepository, error) {
 	repo := &FileURLRepository{
 		InMemoryURLRepository: *NewInMemoryURLRepository(),
 		file:                  file,
 		writer:                bufio.NewWriter(file),
+		clicksFile:            clicksFile,
+		clicksWriter:          bufio.NewWriter(clicksFile),
+		counterFile:           counterFile,
 	}
 
 	// Загружаем существующие данные построчно
@@ -30,74 +48,188 @@ func NewFileURLRepository(file *os.File) (*FileURLRepository, error) {
 		return nil, err
 	}
 
-	// Переходим в конец файла для дальнейшей записи
-	_, err := file.Seek(0, io.SeekEnd)
-	if err != nil {
+	if err := repo.loadClicksFromFile(); err != nil {
+		return nil, err
+	}
+
+	if err := repo.loadCounterFromFile(); err != nil {
+		return nil, err
+	}
+
+	// Переходим в конец файлов для дальнейшей записи
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		return nil, err
+	}
+
+	if _, err := clicksFile.Seek(0, io.SeekEnd); err != nil {
 		return nil, err
 	}
 
 	return repo, nil
 }
 
-func (r *FileURLRepository) Save(ctx context.Context, shortURL, originalURL string) (*model.URLRecord, error) {
-	record, err := r.InMemoryURLRepository.Save(ctx, shortURL, originalURL)
+func (r *FileURLRepository) Save(ctx context.Context, record model.URLRecord) (*model.URLRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	saved, err := r.save(record)
 	if errors.Is(err, ErrURLConflict) {
-		return record, err
+		return saved, err
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	if err := r.appendToFile(record); err != nil {
+	if err := r.appendLocked(*saved); err != nil {
 		return nil, err
 	}
 
-	return record, err
+	return saved, err
 }
 
 func (r *FileURLRepository) SaveBatch(ctx context.Context, records []model.URLRecord) ([]model.URLRecord, error) {
-	// Используем SaveBatch из InMemoryURLRepository для обновления памяти
-	result, err := r.InMemoryURLRepository.SaveBatch(ctx, records)
+	// Новые записи сохраняются под заранее выданными UUID, существующие возвращаются со своими,
+	// так по результату видно, что нужно дописать в файл
+	requested := make(map[uuid.UUID]struct{}, len(records))
+	records = append([]model.URLRecord(nil), records...)
+	for i := range records {
+		if records[i].UUID == uuid.Nil {
+			records[i].UUID = uuid.New()
+		}
+		requested[records[i].UUID] = struct{}{}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result, err := r.saveBatch(records)
 	if err != nil {
 		return nil, err
 	}
 
 	// Записываем все новые записи в файл одним блоком
+	created := make([]model.URLRecord, 0, len(result))
+	for i := range result {
+		// Дубликат внутри пачки получает ту же запись, пишем ее один раз
+		if _, ok := requested[result[i].UUID]; !ok {
+			continue
+		}
+		delete(requested, result[i].UUID)
+		created = append(created, result[i])
+	}
+
+	if err := r.appendLocked(created...); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *FileURLRepository) DeleteBatch(ctx context.Context, userID string, shortURLs []string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	for i := range result {
-		// Проверяем, была ли запись реально добавлена (а не уже существовала)
-		isNew := false
-		for j := range records {
-			if records[j].ShortURL == result[i].ShortURL && records[j].OriginalURL == result[i].OriginalURL {
-				isNew = true
-				break
-			}
-		}
+	deleted := r.markDeleted(userID, shortURLs)
+	if len(deleted) == 0 {
+		return nil
+	}
 
-		if isNew {
-			data, err := json.Marshal(&result[i])
-			if err != nil {
-				return nil, fmt.Errorf("save url record: %w", err)
-			}
+	// Дописываем надгробные записи с is_deleted, при загрузке они перекроют исходные
+	return r.appendLocked(deleted...)
+}
 
-			data = append(data, '\n')
-			if _, err := r.writer.Write(data); err != nil {
-				return nil, fmt.Errorf("save url record: %w", err)
-			}
+func (r *FileURLRepository) UseClick(ctx context.Context, shortURL string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, err := r.useClick(shortURL)
+	if err != nil {
+		return 0, err
+	}
+
+	// Сохраняем остаток переходов, при загрузке запись перекроет предыдущую
+	if err := r.appendLocked(record); err != nil {
+		return 0, err
+	}
+
+	return *record.ClicksLeft, nil
+}
+
+func (r *FileURLRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	expired := r.markExpired(now)
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	if err := r.appendLocked(expired...); err != nil {
+		return 0, err
+	}
+
+	return len(expired), nil
+}
+
+func (r *FileURLRepository) SaveClicks(ctx context.Context, clicks []model.Click) error {
+	if err := r.InMemoryURLRepository.SaveClicks(ctx, clicks); err != nil {
+		return err
+	}
+
+	r.clicksFileMu.Lock()
+	defer r.clicksFileMu.Unlock()
+
+	for i := range clicks {
+		data, err := json.Marshal(&clicks[i])
+		if err != nil {
+			return fmt.Errorf("save clicks: %w", err)
+		}
+
+		data = append(data, '\n')
+		if _, err := r.clicksWriter.Write(data); err != nil {
+			return fmt.Errorf("save clicks: %w", err)
 		}
 	}
 
-	if err := r.writer.Flush(); err != nil {
-		return nil, fmt.Errorf("flush records: %w", err)
+	if err := r.clicksWriter.Flush(); err != nil {
+		return fmt.Errorf("save clicks: %w", err)
 	}
 
-	return result, nil
+	return nil
+}
+
+// NextID увеличивает счетчик и сохраняет его до возврата значения,
+// чтобы после перезапуска не выдать тот же идентификатор повторно
+func (r *FileURLRepository) NextID(ctx context.Context) (uint64, error) {
+	r.counterMu.Lock()
+	defer r.counterMu.Unlock()
+
+	id := r.seq.Load() + 1
+	// Фиксированная ширина, чтобы новое значение полностью затирало старое
+	if _, err := r.counterFile.WriteAt([]byte(fmt.Sprintf("%020d\n", id)), 0); err != nil {
+		return 0, fmt.Errorf("save counter: %w", err)
+	}
+	r.seq.Store(id)
+
+	return id, nil
+}
+
+// Close сбрасывает буферы и закрывает файлы ссылок, переходов и счетчика
+func (r *FileURLRepository) Close() error {
+	r.mu.Lock()
+	flushErr := r.writer.Flush()
+	r.mu.Unlock()
+
+	r.clicksFileMu.Lock()
+	clicksFlushErr := r.clicksWriter.Flush()
+	r.clicksFileMu.Unlock()
+
+	return errors.Join(flushErr, clicksFlushErr, r.file.Close(), r.clicksFile.Close(), r.counterFile.Close())
 }
 
-// Загрузка данных из файла (каждая запись на отдельной строке)
+// Загрузка данных из файла (каждая запись на отдельной строке).
+// Более поздняя запись с тем же short_url заменяет предыдущую.
 func (r *FileURLRepository) loadFromFile() error {
 	scanner := bufio.NewScanner(r.file)
 	for scanner.Scan() {
@@ -105,25 +237,59 @@ func (r *FileURLRepository) loadFromFile() error {
 		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
 			return fmt.Errorf("load url records: %w", err)
 		}
-		r.urls = append(r.urls, record)
+		r.upsert(record)
 	}
 	return scanner.Err()
 }
 
-// Дописываем одну запись в конец файла
-func (r *FileURLRepository) appendToFile(record *model.URLRecord) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// Загрузка журнала переходов (каждый переход на отдельной строке)
+func (r *FileURLRepository) loadClicksFromFile() error {
+	scanner := bufio.NewScanner(r.clicksFile)
+	for scanner.Scan() {
+		var click model.Click
+		if err := json.Unmarshal(scanner.Bytes(), &click); err != nil {
+			return fmt.Errorf("load clicks: %w", err)
+		}
+		r.clicks[click.ShortURL] = append(r.clicks[click.ShortURL], click)
+	}
+	return scanner.Err()
+}
 
-	data, err := json.Marshal(record)
+// Загрузка сохраненного значения счетчика, пустой файл означает новый счетчик
+func (r *FileURLRepository) loadCounterFromFile() error {
+	data, err := io.ReadAll(r.counterFile)
 	if err != nil {
-		return fmt.Errorf("save url record: %w", err)
+		return fmt.Errorf("load counter: %w", err)
 	}
 
-	// Записываем JSON + перевод строки
-	data = append(data, '\n')
-	if _, err := r.writer.Write(data); err != nil {
-		return fmt.Errorf("save url record: %w", err)
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return nil
+	}
+
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("load counter: %w", err)
+	}
+	r.seq.Store(id)
+
+	return nil
+}
+
+// appendLocked дописывает записи в конец файла. Вызывается под той же блокировкой r.mu,
+// что и изменение в памяти, иначе строки попадут в файл не в том порядке, в котором менялись записи.
+func (r *FileURLRepository) appendLocked(records ...model.URLRecord) error {
+	for i := range records {
+		data, err := json.Marshal(&records[i])
+		if err != nil {
+			return fmt.Errorf("save url record: %w", err)
+		}
+
+		// Записываем JSON + перевод строки
+		data = append(data, '\n')
+		if _, err := r.writer.Write(data); err != nil {
+			return fmt.Errorf("save url record: %w", err)
+		}
 	}
 	if err := r.writer.Flush(); err != nil {
 		return fmt.Errorf("save url record: %w", err)
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Gustik/shortener/internal/model"
+)
+
+// openFileRepository открывает хранилище в dir так же, как это делает main
+func openFileRepository(t *testing.T, dir string) *FileURLRepository {
+	t.Helper()
+
+	open := func(name string) *os.File {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_RDWR|os.O_CREATE, 0666)
+		require.NoError(t, err)
+		return f
+	}
+
+	repo, err := NewFileURLRepository(open("urls.json"), open("urls.json.clicks"), open("urls.json.counter"))
+	require.NoError(t, err)
+
+	return repo
+}
+
+func TestFileURLRepository_Reopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	now := time.Now().UTC()
+
+	repo := openFileRepository(t, dir)
+
+	_, err := repo.Save(ctx, model.URLRecord{ShortURL: "plain", OriginalURL: "https://ya.ru", UserID: "user-1"})
+	require.NoError(t, err)
+	_, err = repo.Save(ctx, model.URLRecord{ShortURL: "gone", OriginalURL: "https://go.dev", UserID: "user-1"})
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteBatch(ctx, "user-1", []string{"gone"}))
+
+	expiresAt := now.Add(time.Hour)
+	_, err = repo.Save(ctx, model.URLRecord{ShortURL: "old", OriginalURL: "https://github.com", ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+	expired, err := repo.DeleteExpired(ctx, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, expired)
+
+	clicksLeft := int64(3)
+	_, err = repo.Save(ctx, model.URLRecord{ShortURL: "limited", OriginalURL: "https://invite.ru", ClicksLeft: &clicksLeft})
+	require.NoError(t, err)
+	for range 2 {
+		_, err = repo.UseClick(ctx, "limited")
+		require.NoError(t, err)
+	}
+
+	batch, err := repo.SaveBatch(ctx, []model.URLRecord{
+		{ShortURL: "b1", OriginalURL: "https://batch.ru/1"},
+		{ShortURL: "b2", OriginalURL: "https://ya.ru"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "plain", batch[1].ShortURL, "Дубликат из пачки не пишется в файл повторно")
+
+	require.NoError(t, repo.SaveClicks(ctx, []model.Click{
+		{ShortURL: "plain", ClickedAt: now, IP: "10.0.0.1"},
+		{ShortURL: "plain", ClickedAt: now, IP: "10.0.0.2"},
+	}))
+
+	for range 3 {
+		_, err = repo.NextID(ctx)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, repo.Close())
+
+	repo = openFileRepository(t, dir)
+	t.Cleanup(func() { repo.Close() })
+
+	tests := []struct {
+		shortURL       string
+		wantDeleted    bool
+		wantClicksLeft *int64
+	}{
+		{shortURL: "plain"},
+		{shortURL: "gone", wantDeleted: true},
+		{shortURL: "old", wantDeleted: true},
+		{shortURL: "limited", wantClicksLeft: ptr(int64(1))},
+		{shortURL: "b1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.shortURL, func(t *testing.T) {
+			record, err := repo.GetByShortURL(ctx, tt.shortURL)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantDeleted, record.IsDeleted)
+			assert.Equal(t, tt.wantClicksLeft, record.ClicksLeft)
+			assert.NotNil(t, record.CreatedAt)
+		})
+	}
+
+	_, err = repo.GetByShortURL(ctx, "b2")
+	assert.ErrorIs(t, err, ErrURLNotFound)
+
+	clicks, err := repo.CountClicks(ctx, "plain")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), clicks)
+
+	id, err := repo.NextID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), id, "Счетчик продолжается после перезапуска")
+
+	urls, err := repo.GetByUser(ctx, "user-1")
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, "plain", urls[0].ShortURL)
+
+	existing, err := repo.Save(ctx, model.URLRecord{ShortURL: "again", OriginalURL: "https://ya.ru"})
+	assert.ErrorIs(t, err, ErrURLConflict)
+	assert.Equal(t, "plain", existing.ShortURL)
+
+	_, err = repo.Save(ctx, model.URLRecord{ShortURL: "again", OriginalURL: "https://go.dev"})
+	assert.NoError(t, err, "Удаленная до перезапуска ссылка не мешает сократить URL заново")
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
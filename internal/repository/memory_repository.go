@@ -2,87 +2,391 @@ package repository
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/Gustik/shortener/internal/model"
 )
 
+// InMemoryURLRepository хранит ссылки в памяти с хеш-индексами по short_url, original_url и пользователю.
+// Чтение идет под RLock, поэтому редиректы не ждут друг друга.
 type InMemoryURLRepository struct {
-	mu   sync.Mutex
-	urls []model.URLRecord
+	mu         sync.RWMutex
+	byShort    map[string]*model.URLRecord
+	byOriginal map[string]*model.URLRecord
+	// Ссылки пользователя в порядке создания
+	byUser map[string][]*model.URLRecord
+
+	// Переходы под отдельной блокировкой, чтобы запись статистики не задерживала редиректы
+	clicksMu sync.RWMutex
+	clicks   map[string][]model.Click
+	// Счетчик для генератора short_url на основе последовательности
+	seq atomic.Uint64
 }
 
 func NewInMemoryURLRepository() *InMemoryURLRepository {
 	return &InMemoryURLRepository{
-		urls: make([]model.URLRecord, 0, 10),
+		byShort:    make(map[string]*model.URLRecord),
+		byOriginal: make(map[string]*model.URLRecord),
+		byUser:     make(map[string][]*model.URLRecord),
+		clicks:     make(map[string][]model.Click),
 	}
 }
 
-func (r *InMemoryURLRepository) Save(ctx context.Context, shortURL, originalURL string) (*model.URLRecord, error) {
+func (r *InMemoryURLRepository) NextID(ctx context.Context) (uint64, error) {
+	return r.seq.Add(1), nil
+}
+
+func (r *InMemoryURLRepository) Save(ctx context.Context, record model.URLRecord) (*model.URLRecord, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	for i := range r.urls {
-		if r.urls[i].ShortURL == shortURL {
-			return nil, ErrShortURLConflict
-		}
-		if r.urls[i].OriginalURL == originalURL {
-			return &r.urls[i], ErrURLConflict
-		}
+	return r.save(record)
+}
+
+// save сохраняет запись, вызывается под блокировкой
+func (r *InMemoryURLRepository) save(record model.URLRecord) (*model.URLRecord, error) {
+	now := time.Now().UTC()
+	if _, ok := r.byShort[record.ShortURL]; ok {
+		return nil, ErrShortURLConflict
+	}
+	if existing, ok := r.findDuplicate(record, now); ok {
+		saved := *existing
+		return &saved, ErrURLConflict
 	}
 
-	record := model.URLRecord{UUID: uuid.New(), ShortURL: shortURL, OriginalURL: originalURL}
-	r.urls = append(r.urls, record)
+	record.UUID = uuid.New()
+	record.CreatedAt = &now
+	r.insert(record)
 
 	return &record, nil
 }
 
+// GetByShortURL возвращает копию записи, чтобы вызывающий не читал ее в обход блокировки
 func (r *InMemoryURLRepository) GetByShortURL(ctx context.Context, shortURL string) (*model.URLRecord, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	record, ok := r.byShort[shortURL]
+	if !ok {
+		return nil, ErrURLNotFound
+	}
 
-	for i := range r.urls {
-		if r.urls[i].ShortURL == shortURL {
-			return &r.urls[i], nil
+	found := *record
+	return &found, nil
+}
+
+func (r *InMemoryURLRepository) GetByUser(ctx context.Context, userID string) ([]model.URLRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]model.URLRecord, 0)
+	for _, record := range r.byUser[userID] {
+		if !record.IsDeleted {
+			result = append(result, *record)
 		}
 	}
 
-	return nil, ErrURLNotFound
+	return result, nil
 }
 
 func (r *InMemoryURLRepository) SaveBatch(ctx context.Context, records []model.URLRecord) ([]model.URLRecord, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	return r.saveBatch(records)
+}
+
+// saveBatch сохраняет пачку записей, вызывается под блокировкой
+func (r *InMemoryURLRepository) saveBatch(records []model.URLRecord) ([]model.URLRecord, error) {
+	now := time.Now().UTC()
+
+	// Сначала проверяем всю пачку, чтобы при конфликте ничего не сохранить, как в транзакции
+	var conflicts []int
+	batchShort := make(map[string]struct{}, len(records))
+	for i, record := range records {
+		if _, ok := r.findDuplicate(record, now); ok {
+			continue
+		}
+		if _, ok := r.byShort[record.ShortURL]; ok {
+			conflicts = append(conflicts, i)
+			continue
+		}
+		if _, ok := batchShort[record.ShortURL]; ok {
+			conflicts = append(conflicts, i)
+			continue
+		}
+		batchShort[record.ShortURL] = struct{}{}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, &ShortURLConflictError{Indexes: conflicts}
+	}
+
 	result := make([]model.URLRecord, len(records))
 
 	for i, record := range records {
 		// Проверяем, существует ли уже такой original_url
-		existingRecord := (*model.URLRecord)(nil)
-		for j := range r.urls {
-			if r.urls[j].ShortURL == record.ShortURL {
-				return nil, ErrShortURLConflict
-			}
-			if r.urls[j].OriginalURL == record.OriginalURL {
-				existingRecord = &r.urls[j]
-				break
-			}
+		if existing, ok := r.findDuplicate(record, now); ok {
+			result[i] = *existing
+			continue
 		}
 
-		if existingRecord != nil {
-			result[i] = *existingRecord
-		} else {
+		// UUID может задать вызывающий, чтобы отличить новые записи от существующих
+		if record.UUID == uuid.Nil {
 			record.UUID = uuid.New()
-			r.urls = append(r.urls, record)
-			result[i] = record
 		}
+		record.CreatedAt = &now
+		r.insert(record)
+		result[i] = record
 	}
 
 	return result, nil
 }
 
+func (r *InMemoryURLRepository) DeleteBatch(ctx context.Context, userID string, shortURLs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.markDeleted(userID, shortURLs)
+	return nil
+}
+
+func (r *InMemoryURLRepository) UseClick(ctx context.Context, shortURL string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, err := r.useClick(shortURL)
+	if err != nil {
+		return 0, err
+	}
+	return *record.ClicksLeft, nil
+}
+
+// useClick списывает переход и возвращает копию измененной записи, вызывается под блокировкой
+func (r *InMemoryURLRepository) useClick(shortURL string) (model.URLRecord, error) {
+	record, ok := r.byShort[shortURL]
+	if !ok {
+		return model.URLRecord{}, ErrURLNotFound
+	}
+
+	if record.ClicksLeft == nil || *record.ClicksLeft <= 0 {
+		return model.URLRecord{}, ErrLinkExhausted
+	}
+
+	// Новый указатель, чтобы не менять уже отданные наружу копии записи
+	left := *record.ClicksLeft - 1
+	record.ClicksLeft = &left
+
+	return *record, nil
+}
+
+func (r *InMemoryURLRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.markExpired(now)), nil
+}
+
+// markExpired помечает удаленными просроченные ссылки и возвращает измененные записи,
+// вызывается под блокировкой
+func (r *InMemoryURLRepository) markExpired(now time.Time) []model.URLRecord {
+	expired := make([]model.URLRecord, 0)
+	for _, record := range r.byShort {
+		if record.IsDeleted || !record.IsExpired(now) {
+			continue
+		}
+		record.IsDeleted = true
+		expired = append(expired, *record)
+	}
+
+	return expired
+}
+
+// markDeleted помечает удаленными ссылки пользователя и возвращает измененные записи,
+// вызывается под блокировкой
+func (r *InMemoryURLRepository) markDeleted(userID string, shortURLs []string) []model.URLRecord {
+	deleted := make([]model.URLRecord, 0, len(shortURLs))
+	for _, shortURL := range shortURLs {
+		record, ok := r.byShort[shortURL]
+		// Удалять может только владелец
+		if !ok || record.UserID != userID || record.IsDeleted {
+			continue
+		}
+		record.IsDeleted = true
+		deleted = append(deleted, *record)
+	}
+
+	return deleted
+}
+
+// findDuplicate ищет запись, которую нужно вернуть вместо сохранения record, вызывается под блокировкой.
+// Ссылка с ограничениями всегда создается заново, иначе ограничения потеряются.
+func (r *InMemoryURLRepository) findDuplicate(record model.URLRecord, now time.Time) (*model.URLRecord, bool) {
+	if record.IsRestricted() {
+		return nil, false
+	}
+	return r.activeByOriginal(record.OriginalURL, now)
+}
+
+// activeByOriginal ищет действующую запись без ограничений с original_url, вызывается под блокировкой.
+// Удаленная или просроченная запись не мешает сократить тот же URL заново,
+// новая запись при вставке займет ее место в индексе.
+func (r *InMemoryURLRepository) activeByOriginal(originalURL string, now time.Time) (*model.URLRecord, bool) {
+	existing, ok := r.byOriginal[originalURL]
+	if !ok || existing.IsDeleted || existing.IsExpired(now) {
+		return nil, false
+	}
+	return existing, true
+}
+
+// upsert добавляет запись или заменяет существующую с тем же short_url
+func (r *InMemoryURLRepository) upsert(record model.URLRecord) {
+	existing, ok := r.byShort[record.ShortURL]
+	if !ok {
+		r.insert(record)
+		return
+	}
+
+	if existing.OriginalURL != record.OriginalURL {
+		if r.byOriginal[existing.OriginalURL] == existing {
+			delete(r.byOriginal, existing.OriginalURL)
+		}
+		if !record.IsRestricted() {
+			r.byOriginal[record.OriginalURL] = existing
+		}
+	}
+	if existing.UserID != record.UserID {
+		r.removeFromUser(existing)
+		if record.UserID != "" {
+			r.byUser[record.UserID] = append(r.byUser[record.UserID], existing)
+		}
+	}
+
+	*existing = record
+}
+
+// insert добавляет новую запись во все индексы, вызывается под блокировкой.
+// В byOriginal попадают только записи без ограничений, остальные не участвуют в поиске дубликатов.
+func (r *InMemoryURLRepository) insert(record model.URLRecord) {
+	stored := &record
+	r.byShort[stored.ShortURL] = stored
+	if !stored.IsRestricted() {
+		r.byOriginal[stored.OriginalURL] = stored
+	}
+	if stored.UserID != "" {
+		r.byUser[stored.UserID] = append(r.byUser[stored.UserID], stored)
+	}
+}
+
+func (r *InMemoryURLRepository) removeFromUser(record *model.URLRecord) {
+	if record.UserID == "" {
+		return
+	}
+
+	list := r.byUser[record.UserID]
+	for i := range list {
+		if list[i] == record {
+			r.byUser[record.UserID] = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+
+	if len(r.byUser[record.UserID]) == 0 {
+		delete(r.byUser, record.UserID)
+	}
+}
+
+func (r *InMemoryURLRepository) SaveClicks(ctx context.Context, clicks []model.Click) error {
+	r.clicksMu.Lock()
+	defer r.clicksMu.Unlock()
+
+	for _, c := range clicks {
+		r.clicks[c.ShortURL] = append(r.clicks[c.ShortURL], c)
+	}
+
+	return nil
+}
+
+func (r *InMemoryURLRepository) CountClicks(ctx context.Context, shortURL string) (int64, error) {
+	r.clicksMu.RLock()
+	defer r.clicksMu.RUnlock()
+
+	return int64(len(r.clicks[shortURL])), nil
+}
+
+func (r *InMemoryURLRepository) GetClickAggregate(ctx context.Context, shortURL, granularity string) (*model.ClickAggregate, error) {
+	r.clicksMu.RLock()
+	defer r.clicksMu.RUnlock()
+
+	agg := &model.ClickAggregate{
+		Buckets:    make([]model.StatsBucket, 0),
+		Referrers:  make(map[string]int64),
+		UserAgents: make(map[string]int64),
+	}
+	visitors := make(map[string]struct{})
+	buckets := make(map[time.Time]int64)
+
+	for _, c := range r.clicks[shortURL] {
+		agg.Total++
+		visitors[c.IP] = struct{}{}
+		agg.Referrers[c.Referrer]++
+		agg.UserAgents[c.UserAgent]++
+		buckets[truncateTime(c.ClickedAt, granularity)]++
+
+		if agg.FirstClick == nil || c.ClickedAt.Before(*agg.FirstClick) {
+			agg.FirstClick = &c.ClickedAt
+		}
+		if agg.LastClick == nil || c.ClickedAt.After(*agg.LastClick) {
+			agg.LastClick = &c.ClickedAt
+		}
+	}
+
+	agg.Unique = int64(len(visitors))
+	for start, count := range buckets {
+		agg.Buckets = append(agg.Buckets, model.StatsBucket{Start: start, Count: count})
+	}
+	sort.Slice(agg.Buckets, func(i, j int) bool {
+		return agg.Buckets[i].Start.Before(agg.Buckets[j].Start)
+	})
+
+	return agg, nil
+}
+
+// truncateTime обрезает время до начала часа или дня в UTC
+func truncateTime(t time.Time, granularity string) time.Time {
+	t = t.UTC()
+	if granularity == model.GranularityHour {
+		return t.Truncate(time.Hour)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (r *InMemoryURLRepository) CountURLs(ctx context.Context) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	count := 0
+	for _, record := range r.byShort {
+		if !record.IsDeleted {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (r *InMemoryURLRepository) CountUsers(ctx context.Context) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.byUser), nil
+}
+
 func (r *InMemoryURLRepository) Ping(ctx context.Context) error {
 	return nil
 }
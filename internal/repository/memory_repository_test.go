@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Gustik/shortener/internal/model"
+)
+
+// linearURLRepository прежняя реализация хранилища на срезе с полным перебором, для сравнения.
+// В бенчмарках заполняется напрямую, иначе подготовка сама по себе занимает O(n^2).
+type linearURLRepository struct {
+	mu   sync.Mutex
+	urls []model.URLRecord
+}
+
+func (r *linearURLRepository) Save(record model.URLRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.urls {
+		if r.urls[i].ShortURL == record.ShortURL {
+			return ErrShortURLConflict
+		}
+		if r.urls[i].OriginalURL == record.OriginalURL {
+			return ErrURLConflict
+		}
+	}
+	r.urls = append(r.urls, record)
+
+	return nil
+}
+
+func (r *linearURLRepository) GetByShortURL(shortURL string) (*model.URLRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.urls {
+		if r.urls[i].ShortURL == shortURL {
+			return &r.urls[i], nil
+		}
+	}
+
+	return nil, ErrURLNotFound
+}
+
+func benchRecord(i int) model.URLRecord {
+	return model.URLRecord{
+		ShortURL:    fmt.Sprintf("s%d", i),
+		OriginalURL: fmt.Sprintf("https://bench.example/%d", i),
+		UserID:      fmt.Sprintf("user-%d", i%100),
+	}
+}
+
+var benchSizes = []int{1000, 10000, 100000}
+
+func BenchmarkInMemoryURLRepository_GetByShortURL(b *testing.B) {
+	ctx := context.Background()
+
+	for _, size := range benchSizes {
+		indexed := NewInMemoryURLRepository()
+		linear := &linearURLRepository{}
+		for i := 0; i < size; i++ {
+			indexed.Save(ctx, benchRecord(i))
+			linear.urls = append(linear.urls, benchRecord(i))
+		}
+
+		b.Run(fmt.Sprintf("indexed/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := indexed.GetByShortURL(ctx, fmt.Sprintf("s%d", i%size)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("linear/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := linear.GetByShortURL(fmt.Sprintf("s%d", i%size)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// Параллельные редиректы: RWMutex не сериализует читателей
+func BenchmarkInMemoryURLRepository_GetByShortURLParallel(b *testing.B) {
+	ctx := context.Background()
+	const size = 10000
+
+	indexed := NewInMemoryURLRepository()
+	linear := &linearURLRepository{}
+	for i := 0; i < size; i++ {
+		indexed.Save(ctx, benchRecord(i))
+		linear.urls = append(linear.urls, benchRecord(i))
+	}
+
+	b.Run("indexed", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				indexed.GetByShortURL(ctx, fmt.Sprintf("s%d", i%size))
+				i++
+			}
+		})
+	})
+
+	b.Run("linear", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				linear.GetByShortURL(fmt.Sprintf("s%d", i%size))
+				i++
+			}
+		})
+	})
+}
+
+func BenchmarkInMemoryURLRepository_Save(b *testing.B) {
+	ctx := context.Background()
+
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("indexed/%d", size), func(b *testing.B) {
+			repo := NewInMemoryURLRepository()
+			for i := 0; i < size; i++ {
+				repo.Save(ctx, benchRecord(i))
+			}
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				repo.Save(ctx, benchRecord(size+i))
+			}
+		})
+
+		b.Run(fmt.Sprintf("linear/%d", size), func(b *testing.B) {
+			repo := &linearURLRepository{}
+			for i := 0; i < size; i++ {
+				repo.urls = append(repo.urls, benchRecord(i))
+			}
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				repo.Save(benchRecord(size + i))
+			}
+		})
+	}
+}
+
+func TestInMemoryURLRepository_Indexes(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Повторное сокращение после удаления", func(t *testing.T) {
+		repo := NewInMemoryURLRepository()
+		_, err := repo.Save(ctx, model.URLRecord{ShortURL: "old", OriginalURL: "https://ya.ru", UserID: "user-1"})
+		require.NoError(t, err)
+		require.NoError(t, repo.DeleteBatch(ctx, "user-1", []string{"old"}))
+
+		saved, err := repo.Save(ctx, model.URLRecord{ShortURL: "new", OriginalURL: "https://ya.ru", UserID: "user-1"})
+		require.NoError(t, err, "Удаленная ссылка не мешает сократить URL заново")
+		assert.Equal(t, "new", saved.ShortURL)
+
+		existing, err := repo.Save(ctx, model.URLRecord{ShortURL: "third", OriginalURL: "https://ya.ru"})
+		assert.ErrorIs(t, err, ErrURLConflict)
+		assert.Equal(t, "new", existing.ShortURL)
+
+		old, err := repo.GetByShortURL(ctx, "old")
+		require.NoError(t, err)
+		assert.True(t, old.IsDeleted, "Старая запись остается доступной по short_url")
+
+		urls, err := repo.GetByUser(ctx, "user-1")
+		require.NoError(t, err)
+		require.Len(t, urls, 1)
+		assert.Equal(t, "new", urls[0].ShortURL)
+	})
+
+	t.Run("Ссылки с ограничениями не участвуют в поиске дубликатов", func(t *testing.T) {
+		repo := NewInMemoryURLRepository()
+		past := time.Now().Add(-time.Hour)
+		_, err := repo.Save(ctx, model.URLRecord{ShortURL: "expired", OriginalURL: "https://ya.ru", ExpiresAt: &past})
+		require.NoError(t, err)
+		_, err = repo.Save(ctx, model.URLRecord{ShortURL: "secret", OriginalURL: "https://ya.ru", PasswordHash: "hash"})
+		require.NoError(t, err)
+
+		saved, err := repo.Save(ctx, model.URLRecord{ShortURL: "plain", OriginalURL: "https://ya.ru"})
+		require.NoError(t, err)
+		assert.Equal(t, "plain", saved.ShortURL)
+
+		clicksLeft := int64(1)
+		saved, err = repo.Save(ctx, model.URLRecord{ShortURL: "limited", OriginalURL: "https://ya.ru", ClicksLeft: &clicksLeft})
+		require.NoError(t, err, "Ссылка с ограничением не заменяется существующей")
+		assert.Equal(t, "limited", saved.ShortURL)
+	})
+
+	t.Run("Надгробная запись при загрузке не перехватывает индекс", func(t *testing.T) {
+		repo := NewInMemoryURLRepository()
+		repo.upsert(model.URLRecord{ShortURL: "old", OriginalURL: "https://ya.ru"})
+		repo.upsert(model.URLRecord{ShortURL: "old", OriginalURL: "https://ya.ru", IsDeleted: true})
+		repo.upsert(model.URLRecord{ShortURL: "new", OriginalURL: "https://ya.ru"})
+		// Более поздняя строка старой записи, например остаток переходов
+		repo.upsert(model.URLRecord{ShortURL: "old", OriginalURL: "https://ya.ru", IsDeleted: true})
+
+		existing, err := repo.Save(ctx, model.URLRecord{ShortURL: "third", OriginalURL: "https://ya.ru"})
+		assert.ErrorIs(t, err, ErrURLConflict)
+		assert.Equal(t, "new", existing.ShortURL)
+	})
+
+	t.Run("Смена original_url", func(t *testing.T) {
+		repo := NewInMemoryURLRepository()
+		repo.upsert(model.URLRecord{ShortURL: "link", OriginalURL: "https://ya.ru"})
+		repo.upsert(model.URLRecord{ShortURL: "link", OriginalURL: "https://go.dev"})
+
+		_, err := repo.Save(ctx, model.URLRecord{ShortURL: "ya", OriginalURL: "https://ya.ru"})
+		assert.NoError(t, err, "Прежний original_url освобождается")
+
+		existing, err := repo.Save(ctx, model.URLRecord{ShortURL: "godev", OriginalURL: "https://go.dev"})
+		assert.ErrorIs(t, err, ErrURLConflict)
+		assert.Equal(t, "link", existing.ShortURL)
+	})
+
+	t.Run("Смена пользователя", func(t *testing.T) {
+		repo := NewInMemoryURLRepository()
+		repo.upsert(model.URLRecord{ShortURL: "a", OriginalURL: "https://ya.ru", UserID: "user-1"})
+		repo.upsert(model.URLRecord{ShortURL: "b", OriginalURL: "https://go.dev", UserID: "user-1"})
+		repo.upsert(model.URLRecord{ShortURL: "a", OriginalURL: "https://ya.ru", UserID: "user-2"})
+
+		urls, err := repo.GetByUser(ctx, "user-1")
+		require.NoError(t, err)
+		require.Len(t, urls, 1)
+		assert.Equal(t, "b", urls[0].ShortURL)
+
+		urls, err = repo.GetByUser(ctx, "user-2")
+		require.NoError(t, err)
+		require.Len(t, urls, 1)
+		assert.Equal(t, "a", urls[0].ShortURL)
+
+		repo.upsert(model.URLRecord{ShortURL: "b", OriginalURL: "https://go.dev"})
+
+		users, err := repo.CountUsers(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, users, "Пользователь без ссылок убирается из индекса")
+	})
+}
+
+func TestInMemoryURLRepository_ClicksDoNotBlockRedirects(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryURLRepository()
+	_, err := repo.Save(ctx, model.URLRecord{ShortURL: "link", OriginalURL: "https://ya.ru"})
+	require.NoError(t, err)
+
+	// Имитируем долгую запись переходов
+	repo.clicksMu.Lock()
+	defer repo.clicksMu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := repo.GetByShortURL(ctx, "link")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Редирект не должен ждать записи переходов")
+	}
+}
@@ -3,6 +3,8 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/Gustik/shortener/internal/model"
 )
@@ -11,11 +13,49 @@ var (
 	ErrURLNotFound      = errors.New("URL not found")
 	ErrURLConflict      = errors.New("URL already exists")
 	ErrShortURLConflict = errors.New("short URL already exists")
+	ErrLinkExhausted    = errors.New("link click limit exhausted")
 )
 
+// ShortURLConflictError возвращается из SaveBatch, когда short_url записей пачки уже заняты.
+// Indexes указывает позиции конфликтующих записей, пачка при этом не сохраняется.
+type ShortURLConflictError struct {
+	Indexes []int
+}
+
+func (e *ShortURLConflictError) Error() string {
+	return fmt.Sprintf("%s: records %v", ErrShortURLConflict, e.Indexes)
+}
+
+func (e *ShortURLConflictError) Unwrap() error {
+	return ErrShortURLConflict
+}
+
 type URLRepository interface {
-	Save(ctx context.Context, shortURL, originalURL string) (*model.URLRecord, error)
+	// Save сохраняет запись. Если original_url уже сокращен действующей ссылкой без ограничений,
+	// возвращает ее вместе с ErrURLConflict. Запись с ограничениями (model.URLRecord.IsRestricted)
+	// всегда сохраняется как новая.
+	Save(ctx context.Context, record model.URLRecord) (*model.URLRecord, error)
+	// SaveBatch сохраняет записи атомарно. Дубликаты original_url ищутся так же, как в Save,
+	// вместо них возвращается сохраненная ранее запись. При занятых short_url - *ShortURLConflictError.
 	SaveBatch(ctx context.Context, records []model.URLRecord) ([]model.URLRecord, error)
 	GetByShortURL(ctx context.Context, shortURL string) (*model.URLRecord, error)
+	GetByUser(ctx context.Context, userID string) ([]model.URLRecord, error)
+	DeleteBatch(ctx context.Context, userID string, shortURLs []string) error
+	// UseClick атомарно списывает переход у ссылки с ограничением и возвращает остаток.
+	// Если переходы закончились, возвращает ErrLinkExhausted.
+	UseClick(ctx context.Context, shortURL string) (int64, error)
+	// DeleteExpired помечает удаленными ссылки с истекшим сроком и возвращает их количество
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+	SaveClicks(ctx context.Context, clicks []model.Click) error
+	// CountClicks возвращает общее число переходов по ссылке
+	CountClicks(ctx context.Context, shortURL string) (int64, error)
+	// GetClickAggregate считает переходы по ссылке, группируя их по granularity (hour или day, в UTC)
+	GetClickAggregate(ctx context.Context, shortURL, granularity string) (*model.ClickAggregate, error)
+	// CountURLs возвращает количество неудаленных ссылок
+	CountURLs(ctx context.Context) (int, error)
+	// CountUsers возвращает количество пользователей, создававших ссылки
+	CountUsers(ctx context.Context) (int, error)
+	// NextID возвращает следующее значение монотонного счетчика для генерации short_url
+	NextID(ctx context.Context) (uint64, error)
 	Ping(ctx context.Context) error
 }
@@ -5,45 +5,55 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/Gustik/shortener/internal/model"
 )
 
 const pgDuplicateErrorCode = "23505"
 
+// Колонки записи в порядке, который ожидает scanURLRecord
+const urlColumns = `id, short_url, original_url, COALESCE(user_id, ''), is_deleted, expires_at, clicks_left, COALESCE(password_hash, ''), created_at`
+
 type SQLURLRepository struct {
-	conn *pgx.Conn
+	pool *pgxpool.Pool
 }
 
-func NewSQLRepository(conn *pgx.Conn) (*SQLURLRepository, error) {
+func NewSQLRepository(pool *pgxpool.Pool) (*SQLURLRepository, error) {
 	return &SQLURLRepository{
-		conn: conn,
+		pool: pool,
 	}, nil
 }
 
-func (r SQLURLRepository) Save(ctx context.Context, shortURL, originalURL string) (*model.URLRecord, error) {
+// plainURLCondition выделяет действующие записи без ограничений. Только на них распространяется
+// уникальный индекс по original_url, ссылки с паролем, лимитом переходов или сроком жизни создаются отдельно.
+const plainURLCondition = `NOT is_deleted AND expires_at IS NULL AND clicks_left IS NULL AND password_hash IS NULL`
+
+func (r SQLURLRepository) Save(ctx context.Context, record model.URLRecord) (*model.URLRecord, error) {
 	query := `
-        INSERT INTO urls (short_url, original_url) 
-        VALUES ($1, $2)
-        ON CONFLICT (original_url) DO NOTHING
-        RETURNING id, short_url, original_url
-    `
+        INSERT INTO urls (short_url, original_url, user_id, expires_at, clicks_left, password_hash)
+        VALUES ($1, $2, NULLIF($3, ''), $4, $5, NULLIF($6, ''))
+        ON CONFLICT (original_url) WHERE ` + plainURLCondition + ` DO NOTHING
+        RETURNING ` + urlColumns
 
-	var record model.URLRecord
-	err := r.conn.QueryRow(ctx, query, shortURL, originalURL).Scan(
-		&record.UUID,
-		&record.ShortURL,
-		&record.OriginalURL,
-	)
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var saved model.URLRecord
+	err = scanURLRecord(tx.QueryRow(ctx, query, record.ShortURL, record.OriginalURL, record.UserID, record.ExpiresAt, record.ClicksLeft, record.PasswordHash), &saved)
 
 	if err != nil {
 		// Если INSERT был пропущен из-за конфликта по original_url, RETURNING ничего не вернёт
 		if err == pgx.ErrNoRows {
 			// Получаем существующую запись
-			existsURL, err := r.getByOriginalURL(ctx, originalURL)
+			existsURL, err := getByOriginalURL(ctx, tx, record.OriginalURL)
 			if err != nil {
 				return nil, err
 			}
@@ -62,37 +72,97 @@ func (r SQLURLRepository) Save(ctx context.Context, shortURL, originalURL string
 		return nil, fmt.Errorf("ошибка сохранения URL: %w", err)
 	}
 
-	return &record, nil
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("ошибка коммита транзакции: %w", err)
+	}
+
+	return &saved, nil
 }
 
+// saveBatchQuery для дубликата по original_url возвращает уже существующую запись.
+// Нулевой UUID заменяется сгенерированным в БД.
+const saveBatchQuery = `
+	INSERT INTO urls (id, short_url, original_url, user_id, expires_at, clicks_left, password_hash)
+	VALUES (COALESCE(NULLIF($1::uuid, '00000000-0000-0000-0000-000000000000'), gen_random_uuid()),
+		$2, $3, NULLIF($4, ''), $5, $6, NULLIF($7, ''))
+	ON CONFLICT (original_url) WHERE ` + plainURLCondition + ` DO UPDATE SET original_url = EXCLUDED.original_url
+	RETURNING ` + urlColumns
+
+// shortURLConflictsQuery возвращает позиции записей пачки, у которых short_url уже занят.
+// Записи без ограничений с действующим original_url пропускаются, для них вернется сохраненная ранее запись.
+const shortURLConflictsQuery = `
+	SELECT t.idx - 1
+	FROM unnest($1::text[], $2::text[], $3::bool[]) WITH ORDINALITY AS t(short_url, original_url, restricted, idx)
+	WHERE EXISTS (SELECT 1 FROM urls u WHERE u.short_url = t.short_url)
+		AND (t.restricted OR NOT EXISTS (
+			SELECT 1 FROM urls u WHERE u.original_url = t.original_url AND ` + plainURLCondition + `))
+	ORDER BY t.idx`
+
+// SaveBatch сохраняет записи в одной транзакции на соединении из пула.
+// Все вставки уходят одним пакетом pgx.Batch, поэтому пачка занимает один round trip.
 func (r SQLURLRepository) SaveBatch(ctx context.Context, records []model.URLRecord) ([]model.URLRecord, error) {
-	tx, err := r.conn.Begin(ctx)
+	tx, err := r.pool.Begin(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка начала транзакции: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	result := make([]model.URLRecord, len(records))
+	result, err := sendSaveBatch(ctx, tx, records)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("ошибка коммита транзакции: %w", err)
+	}
+
+	return result, nil
+}
 
+// sendSaveBatch отправляет вставки пакетом и читает результаты в исходном порядке.
+// Результаты пакета закрываются до коммита транзакции.
+func sendSaveBatch(ctx context.Context, tx pgx.Tx, records []model.URLRecord) ([]model.URLRecord, error) {
+	shortURLs := make([]string, len(records))
+	originals := make([]string, len(records))
+	restricted := make([]bool, len(records))
+	for i := range records {
+		shortURLs[i] = records[i].ShortURL
+		originals[i] = records[i].OriginalURL
+		restricted[i] = records[i].IsRestricted()
+	}
+
+	// Занятые short_url ищутся до вставок, чтобы вернуть все конфликты сразу.
+	// Вставки при этом уже в пакете, после конфликта их результат не читается и транзакция откатывается.
+	batch := &pgx.Batch{}
+	batch.Queue(shortURLConflictsQuery, shortURLs, originals, restricted)
+	for _, record := range records {
+		batch.Queue(saveBatchQuery, record.UUID, record.ShortURL, record.OriginalURL, record.UserID, record.ExpiresAt, record.ClicksLeft, record.PasswordHash)
+	}
+
+	br := tx.SendBatch(ctx, batch)
+	defer br.Close()
+
+	rows, _ := br.Query()
+	conflicts, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("ошибка проверки short_url: %w", err)
+	}
+
+	if len(conflicts) > 0 {
+		return nil, &ShortURLConflictError{Indexes: conflicts}
+	}
+
+	result := make([]model.URLRecord, len(records))
 	for i, record := range records {
-		query := `
-			INSERT INTO urls (short_url, original_url)
-			VALUES ($1, $2)
-			ON CONFLICT (original_url) DO UPDATE SET original_url = EXCLUDED.original_url
-			RETURNING id, short_url, original_url
-		`
-
-		err := tx.QueryRow(ctx, query, record.ShortURL, record.OriginalURL).Scan(
-			&result[i].UUID,
-			&result[i].ShortURL,
-			&result[i].OriginalURL,
-		)
+		err := scanURLRecord(br.QueryRow(), &result[i])
 
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == pgDuplicateErrorCode {
-			// Это unique violation - возможно по short_url
+			// Это unique violation - возможно по short_url. Занятые short_url отсеяны проверкой выше,
+			// сюда попадают гонки с параллельной вставкой и одинаковые алиасы внутри пачки.
+			// Транзакция уже прервана, поэтому известен только первый такой конфликт.
 			if strings.Contains(pgErr.ConstraintName, "short_url") {
-				return nil, ErrShortURLConflict
+				return nil, &ShortURLConflictError{Indexes: []int{i}}
 			}
 		}
 
@@ -101,22 +171,18 @@ func (r SQLURLRepository) SaveBatch(ctx context.Context, records []model.URLReco
 		}
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		return nil, fmt.Errorf("ошибка коммита транзакции: %w", err)
+	if err := br.Close(); err != nil {
+		return nil, fmt.Errorf("ошибка завершения пакета: %w", err)
 	}
 
 	return result, nil
 }
 
 func (r SQLURLRepository) GetByShortURL(ctx context.Context, shortURL string) (*model.URLRecord, error) {
-	query := `SELECT id, short_url, original_url FROM urls WHERE short_url = $1`
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE short_url = $1`
 
 	var record model.URLRecord
-	err := r.conn.QueryRow(ctx, query, shortURL).Scan(
-		&record.UUID,
-		&record.ShortURL,
-		&record.OriginalURL,
-	)
+	err := scanURLRecord(r.pool.QueryRow(ctx, query, shortURL), &record)
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -128,15 +194,205 @@ func (r SQLURLRepository) GetByShortURL(ctx context.Context, shortURL string) (*
 	return &record, nil
 }
 
-func (r SQLURLRepository) getByOriginalURL(ctx context.Context, originalURL string) (*model.URLRecord, error) {
-	query := `SELECT id, short_url, original_url FROM urls WHERE original_url = $1`
+func (r SQLURLRepository) GetByUser(ctx context.Context, userID string) ([]model.URLRecord, error) {
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE user_id = $1 AND NOT is_deleted ORDER BY created_at`
 
-	var record model.URLRecord
-	err := r.conn.QueryRow(ctx, query, originalURL).Scan(
-		&record.UUID,
-		&record.ShortURL,
-		&record.OriginalURL,
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения URL пользователя: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]model.URLRecord, 0)
+	for rows.Next() {
+		var record model.URLRecord
+		if err := scanURLRecord(rows, &record); err != nil {
+			return nil, fmt.Errorf("ошибка чтения URL пользователя: %w", err)
+		}
+		result = append(result, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка получения URL пользователя: %w", err)
+	}
+
+	return result, nil
+}
+
+func (r SQLURLRepository) DeleteBatch(ctx context.Context, userID string, shortURLs []string) error {
+	query := `UPDATE urls SET is_deleted = TRUE WHERE user_id = $1 AND short_url = ANY($2) AND NOT is_deleted`
+
+	if _, err := r.pool.Exec(ctx, query, userID, shortURLs); err != nil {
+		return fmt.Errorf("ошибка удаления URL пользователя: %w", err)
+	}
+
+	return nil
+}
+
+func (r SQLURLRepository) UseClick(ctx context.Context, shortURL string) (int64, error) {
+	query := `
+		UPDATE urls SET clicks_left = clicks_left - 1
+		WHERE short_url = $1 AND clicks_left > 0
+		RETURNING clicks_left
+	`
+
+	var left int64
+	err := r.pool.QueryRow(ctx, query, shortURL).Scan(&left)
+	if err != nil {
+		// Ни одна строка не обновилась - переходы закончились или ограничения нет
+		if err == pgx.ErrNoRows {
+			return 0, ErrLinkExhausted
+		}
+		return 0, fmt.Errorf("ошибка списания перехода: %w", err)
+	}
+
+	return left, nil
+}
+
+func (r SQLURLRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	query := `UPDATE urls SET is_deleted = TRUE WHERE expires_at <= $1 AND NOT is_deleted`
+
+	tag, err := r.pool.Exec(ctx, query, now)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка удаления просроченных URL: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+func (r SQLURLRepository) SaveClicks(ctx context.Context, clicks []model.Click) error {
+	rows := make([][]any, len(clicks))
+	for i, c := range clicks {
+		rows[i] = []any{c.ShortURL, c.ClickedAt, c.Referrer, c.UserAgent, c.IP}
+	}
+
+	_, err := r.pool.CopyFrom(
+		ctx,
+		pgx.Identifier{"clicks"},
+		[]string{"short_url", "clicked_at", "referrer", "user_agent", "ip"},
+		pgx.CopyFromRows(rows),
 	)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения переходов: %w", err)
+	}
+
+	return nil
+}
+
+func (r SQLURLRepository) CountClicks(ctx context.Context, shortURL string) (int64, error) {
+	var count int64
+	if err := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM clicks WHERE short_url = $1`, shortURL).Scan(&count); err != nil {
+		return 0, fmt.Errorf("ошибка подсчета переходов: %w", err)
+	}
+
+	return count, nil
+}
+
+func (r SQLURLRepository) GetClickAggregate(ctx context.Context, shortURL, granularity string) (*model.ClickAggregate, error) {
+	agg := &model.ClickAggregate{
+		Buckets:    make([]model.StatsBucket, 0),
+		Referrers:  make(map[string]int64),
+		UserAgents: make(map[string]int64),
+	}
+
+	summaryQuery := `
+		SELECT COUNT(*), COUNT(DISTINCT ip), MIN(clicked_at), MAX(clicked_at)
+		FROM clicks WHERE short_url = $1
+	`
+	err := r.pool.QueryRow(ctx, summaryQuery, shortURL).Scan(&agg.Total, &agg.Unique, &agg.FirstClick, &agg.LastClick)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета переходов: %w", err)
+	}
+
+	bucketsQuery := `
+		SELECT date_trunc($2, clicked_at, 'UTC') AS bucket, COUNT(*)
+		FROM clicks WHERE short_url = $1
+		GROUP BY bucket ORDER BY bucket
+	`
+	rows, err := r.pool.Query(ctx, bucketsQuery, shortURL, granularity)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка группировки переходов: %w", err)
+	}
+	for rows.Next() {
+		var b model.StatsBucket
+		if err := rows.Scan(&b.Start, &b.Count); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка группировки переходов: %w", err)
+		}
+		b.Start = b.Start.UTC()
+		agg.Buckets = append(agg.Buckets, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка группировки переходов: %w", err)
+	}
+
+	if err := r.countClicksBy(ctx, shortURL, "referrer", agg.Referrers); err != nil {
+		return nil, err
+	}
+
+	if err := r.countClicksBy(ctx, shortURL, "user_agent", agg.UserAgents); err != nil {
+		return nil, err
+	}
+
+	return agg, nil
+}
+
+// countClicksBy считает переходы по значениям колонки column
+func (r SQLURLRepository) countClicksBy(ctx context.Context, shortURL, column string, dst map[string]int64) error {
+	query := `SELECT ` + column + `, COUNT(*) FROM clicks WHERE short_url = $1 GROUP BY ` + column
+
+	rows, err := r.pool.Query(ctx, query, shortURL)
+	if err != nil {
+		return fmt.Errorf("ошибка подсчета переходов по %s: %w", column, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value string
+		var count int64
+		if err := rows.Scan(&value, &count); err != nil {
+			return fmt.Errorf("ошибка подсчета переходов по %s: %w", column, err)
+		}
+		dst[value] = count
+	}
+
+	return rows.Err()
+}
+
+func (r SQLURLRepository) CountURLs(ctx context.Context) (int, error) {
+	var count int
+	if err := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM urls WHERE NOT is_deleted`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("ошибка подсчета URL: %w", err)
+	}
+
+	return count, nil
+}
+
+func (r SQLURLRepository) CountUsers(ctx context.Context) (int, error) {
+	var count int
+	if err := r.pool.QueryRow(ctx, `SELECT COUNT(DISTINCT user_id) FROM urls`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("ошибка подсчета пользователей: %w", err)
+	}
+
+	return count, nil
+}
+
+func (r SQLURLRepository) NextID(ctx context.Context) (uint64, error) {
+	var id int64
+	if err := r.pool.QueryRow(ctx, `SELECT nextval('short_id_seq')`).Scan(&id); err != nil {
+		return 0, fmt.Errorf("ошибка получения значения последовательности: %w", err)
+	}
+
+	return uint64(id), nil
+}
+
+// getByOriginalURL возвращает действующую запись без ограничений с original_url
+func getByOriginalURL(ctx context.Context, tx pgx.Tx, originalURL string) (*model.URLRecord, error) {
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE original_url = $1 AND ` + plainURLCondition
+
+	var record model.URLRecord
+	err := scanURLRecord(tx.QueryRow(ctx, query, originalURL), &record)
 
 	if err != nil {
 		return nil, fmt.Errorf("ошибка получения URL: %w", err)
@@ -145,6 +401,29 @@ func (r SQLURLRepository) getByOriginalURL(ctx context.Context, originalURL stri
 	return &record, nil
 }
 
+// Ping берет соединение из пула и проверяет его.
+// При ошибке добавляет состояние пула, чтобы было видно, исчерпан ли он.
 func (r SQLURLRepository) Ping(ctx context.Context) error {
-	return r.conn.Ping(ctx)
+	if err := r.pool.Ping(ctx); err != nil {
+		stat := r.pool.Stat()
+		return fmt.Errorf("ошибка проверки подключения к БД (соединений: всего %d, занято %d, свободно %d, максимум %d): %w",
+			stat.TotalConns(), stat.AcquiredConns(), stat.IdleConns(), stat.MaxConns(), err)
+	}
+
+	return nil
+}
+
+// scanURLRecord читает строку, выбранную с колонками urlColumns
+func scanURLRecord(row pgx.Row, record *model.URLRecord) error {
+	return row.Scan(
+		&record.UUID,
+		&record.ShortURL,
+		&record.OriginalURL,
+		&record.UserID,
+		&record.IsDeleted,
+		&record.ExpiresAt,
+		&record.ClicksLeft,
+		&record.PasswordHash,
+		&record.CreatedAt,
+	)
 }
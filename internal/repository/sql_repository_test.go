@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Gustik/shortener/internal/model"
+)
+
+// Бенчмарки работают с настоящей БД, DSN передается через TEST_DATABASE_DSN:
+//
+//	TEST_DATABASE_DSN=postgres://... go test -run '^$' -bench SaveBatch ./internal/repository
+func newBenchPool(b *testing.B) *pgxpool.Pool {
+	b.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		b.Skip("TEST_DATABASE_DSN не задан")
+	}
+
+	m, err := migrate.New("file://../../migrations", dsn)
+	if err != nil {
+		b.Fatalf("ошибка создания migrate instance: %v", err)
+	}
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		b.Fatalf("ошибка применения миграций: %v", err)
+	}
+	m.Close()
+
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		b.Fatalf("ошибка подключения к БД: %v", err)
+	}
+	b.Cleanup(pool.Close)
+
+	return pool
+}
+
+func benchRecords(prefix string, n int) []model.URLRecord {
+	records := make([]model.URLRecord, n)
+	for i := range records {
+		records[i] = model.URLRecord{
+			ShortURL:    fmt.Sprintf("%s%d", prefix, i),
+			OriginalURL: fmt.Sprintf("https://bench.example/%s/%d", prefix, i),
+		}
+	}
+	return records
+}
+
+// saveBatchPerRow прежняя реализация SaveBatch с отдельным запросом на каждую запись, для сравнения
+func saveBatchPerRow(ctx context.Context, pool *pgxpool.Pool, records []model.URLRecord) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var saved model.URLRecord
+	for _, record := range records {
+		row := tx.QueryRow(ctx, saveBatchQuery, record.UUID, record.ShortURL, record.OriginalURL, record.UserID, record.ExpiresAt, record.ClicksLeft, record.PasswordHash)
+		if err := scanURLRecord(row, &saved); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func BenchmarkSQLURLRepository_SaveBatch(b *testing.B) {
+	pool := newBenchPool(b)
+	repo, _ := NewSQLRepository(pool)
+	ctx := context.Background()
+
+	b.Cleanup(func() {
+		pool.Exec(ctx, `DELETE FROM urls WHERE original_url LIKE 'https://bench.example/%'`)
+	})
+
+	for _, size := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("batch/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				records := benchRecords(fmt.Sprintf("b%d-%d-", size, i), size)
+				b.StartTimer()
+
+				if _, err := repo.SaveBatch(ctx, records); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("per-row/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				records := benchRecords(fmt.Sprintf("r%d-%d-", size, i), size)
+				b.StartTimer()
+
+				if err := saveBatchPerRow(ctx, pool, records); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
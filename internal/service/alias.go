@@ -0,0 +1,48 @@
+package service
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	minAliasLength = 3
+	maxAliasLength = 64
+)
+
+var (
+	ErrInvalidAlias = errors.New("custom alias is invalid")
+	ErrAliasTaken   = errors.New("custom alias already taken")
+)
+
+// Зарезервированные слова, которые пересекаются с маршрутами сервиса
+var reservedAliases = map[string]struct{}{
+	"api":  {},
+	"ping": {},
+}
+
+// validateAlias проверяет длину, алфавит и зарезервированные слова
+func validateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return ErrInvalidAlias
+	}
+
+	for _, c := range alias {
+		if !isAliasChar(c) {
+			return ErrInvalidAlias
+		}
+	}
+
+	if _, ok := reservedAliases[strings.ToLower(alias)]; ok {
+		return ErrInvalidAlias
+	}
+
+	return nil
+}
+
+func isAliasChar(c rune) bool {
+	return c >= 'a' && c <= 'z' ||
+		c >= 'A' && c <= 'Z' ||
+		c >= '0' && c <= '9' ||
+		c == '-' || c == '_'
+}
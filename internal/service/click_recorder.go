@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Gustik/shortener/internal/model"
+	"github.com/Gustik/shortener/internal/repository"
+)
+
+const (
+	clickQueueSize     = 4096
+	clickBatchSize     = 500
+	clickFlushInterval = time.Second
+	clickSaveTimeout   = 10 * time.Second
+)
+
+// ClickRecorder сохраняет переходы в фоне пачками, чтобы не задерживать редиректы.
+// Если очередь переполнена, переход отбрасывается.
+type ClickRecorder struct {
+	repo   repository.URLRepository
+	logger *zap.Logger
+
+	mu     sync.RWMutex
+	closed bool
+	clicks chan model.Click
+	done   chan struct{}
+}
+
+func NewClickRecorder(repo repository.URLRepository, logger *zap.Logger) *ClickRecorder {
+	c := &ClickRecorder{
+		repo:   repo,
+		logger: logger,
+		clicks: make(chan model.Click, clickQueueSize),
+		done:   make(chan struct{}),
+	}
+
+	go c.run()
+
+	return c
+}
+
+// Record ставит переход в очередь без блокировки
+func (c *ClickRecorder) Record(click model.Click) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return
+	}
+
+	select {
+	case c.clicks <- click:
+	default:
+		c.logger.Warn("очередь переходов переполнена, переход отброшен", zap.String("short_url", click.ShortURL))
+	}
+}
+
+// Close перестает принимать переходы и дожидается сохранения накопленных
+func (c *ClickRecorder) Close() {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.clicks)
+	}
+	c.mu.Unlock()
+
+	<-c.done
+}
+
+func (c *ClickRecorder) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(clickFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]model.Click, 0, clickBatchSize)
+
+	for {
+		select {
+		case click, ok := <-c.clicks:
+			if !ok {
+				c.flush(batch)
+				return
+			}
+
+			batch = append(batch, click)
+			if len(batch) >= clickBatchSize {
+				c.flush(batch)
+				batch = make([]model.Click, 0, clickBatchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				c.flush(batch)
+				batch = make([]model.Click, 0, clickBatchSize)
+			}
+		}
+	}
+}
+
+func (c *ClickRecorder) flush(batch []model.Click) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clickSaveTimeout)
+	defer cancel()
+
+	if err := c.repo.SaveClicks(ctx, batch); err != nil {
+		c.logger.Error("не удалось сохранить переходы", zap.Int("count", len(batch)), zap.Error(err))
+	}
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var ErrDestinationBlocked = errors.New("destination is blocked")
+
+// destinationRule совпадает с доменом и его поддоменами либо с регулярным выражением для всего URL
+type destinationRule struct {
+	domain string
+	re     *regexp.Regexp
+}
+
+func (r destinationRule) match(host, rawURL string) bool {
+	if r.re != nil {
+		return r.re.MatchString(rawURL)
+	}
+
+	return host == r.domain || strings.HasSuffix(host, "."+r.domain)
+}
+
+type destinationRuleSet struct {
+	block []destinationRule
+	allow []destinationRule
+}
+
+// DestinationRules ограничивает адреса, на которые можно сокращать ссылки.
+// Правила читаются из файла и перечитываются через Reload без перезапуска сервера.
+//
+// Формат файла - по правилу на строку, строки с # пропускаются:
+//
+//	# домен и все его поддомены
+//	block evil.com
+//	# регулярное выражение для всего URL
+//	block ~^https?://[^/]+\.zip/
+//	allow example.org
+//
+// Если есть хотя бы одно правило allow, разрешены только подходящие под них адреса.
+// Правила block проверяются первыми.
+type DestinationRules struct {
+	path string
+
+	mu    sync.RWMutex
+	rules *destinationRuleSet
+}
+
+func NewDestinationRules(path string) (*DestinationRules, error) {
+	r := &DestinationRules{path: path}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload перечитывает файл правил. При ошибке остаются действовать прежние правила.
+func (r *DestinationRules) Reload() error {
+	rules, err := loadDestinationRules(r.path)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.rules = rules
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Check возвращает ErrDestinationBlocked, если переход по URL запрещен правилами
+func (r *DestinationRules) Check(rawURL string) error {
+	r.mu.RLock()
+	rules := r.rules
+	r.mu.RUnlock()
+
+	var host string
+	if u, err := url.Parse(rawURL); err == nil {
+		// Точка в конце имени не должна уводить хост из-под правил
+		host = strings.TrimRight(strings.ToLower(u.Hostname()), ".")
+	}
+
+	for _, rule := range rules.block {
+		if rule.match(host, rawURL) {
+			return ErrDestinationBlocked
+		}
+	}
+
+	if len(rules.allow) == 0 {
+		return nil
+	}
+
+	for _, rule := range rules.allow {
+		if rule.match(host, rawURL) {
+			return nil
+		}
+	}
+
+	return ErrDestinationBlocked
+}
+
+func loadDestinationRules(path string) (*destinationRuleSet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("load destination rules: %w", err)
+	}
+	defer file.Close()
+
+	rules := &destinationRuleSet{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		action, pattern, ok := strings.Cut(text, " ")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("load destination rules: line %d: expected \"<block|allow> <pattern>\"", line)
+		}
+
+		rule, err := parseDestinationRule(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("load destination rules: line %d: %w", line, err)
+		}
+
+		switch action {
+		case "block":
+			rules.block = append(rules.block, rule)
+		case "allow":
+			rules.allow = append(rules.allow, rule)
+		default:
+			return nil, fmt.Errorf("load destination rules: line %d: unknown action %q", line, action)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("load destination rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+func parseDestinationRule(pattern string) (destinationRule, error) {
+	if expr, ok := strings.CutPrefix(pattern, "~"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return destinationRule{}, err
+		}
+		return destinationRule{re: re}, nil
+	}
+
+	domain := strings.TrimPrefix(strings.ToLower(pattern), "*.")
+	domain, err := normalizeHost(strings.TrimPrefix(domain, "."))
+	if err != nil {
+		return destinationRule{}, err
+	}
+
+	return destinationRule{domain: domain}, nil
+}
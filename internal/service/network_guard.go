@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	lookupTimeout = 3 * time.Second
+	// maxParallelLookups ограничивает число одновременных DNS-запросов при проверке пачки
+	maxParallelLookups = 8
+)
+
+var (
+	ErrPrivateDestination = errors.New("destination resolves to a private network address")
+	ErrUnresolvableHost   = errors.New("URL host cannot be resolved")
+)
+
+// Resolver разрешает имя хоста в адреса, его реализует *net.Resolver
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// internalPrefixes диапазоны, которые не покрываются методами netip.Addr
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	// Carrier-grade NAT, в нем же metadata некоторых облаков (100.100.100.200)
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	// NAT64 может вести во внутреннюю сеть IPv4
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// PrivateNetworkGuard не дает сокращать ссылки на loopback, RFC 1918, link-local
+// (в том числе metadata 169.254.169.254) и прочие внутренние адреса.
+// Проверка выполняется при сохранении, поэтому сервис, который сам ходит по ссылкам,
+// должен повторять ее при соединении, иначе DNS может вернуть другой адрес.
+type PrivateNetworkGuard struct {
+	resolver Resolver
+	// allowed внутренние подсети, на которые ссылаться можно, например intranet
+	allowed []netip.Prefix
+}
+
+func NewPrivateNetworkGuard(resolver Resolver, allowedCIDRs []string) (*PrivateNetworkGuard, error) {
+	allowed := make([]netip.Prefix, 0, len(allowedCIDRs))
+	for _, cidr := range allowedCIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parse allowed CIDR: %w", err)
+		}
+		allowed = append(allowed, prefix.Masked())
+	}
+
+	return &PrivateNetworkGuard{resolver: resolver, allowed: allowed}, nil
+}
+
+// Check разрешает хост URL и отклоняет его, если хотя бы один адрес внутренний
+func (g *PrivateNetworkGuard) Check(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	return g.checkHost(ctx, u.Hostname())
+}
+
+// CheckBatch проверяет URL пачки как Check. Каждый хост разрешается один раз,
+// разные хосты параллельно, но не больше maxParallelLookups одновременно.
+// Возвращает ошибку первого по порядку URL, не прошедшего проверку.
+func (g *PrivateNetworkGuard) CheckBatch(ctx context.Context, rawURLs []string) error {
+	hosts := make([]string, len(rawURLs))
+	// Позиция хоста в unique, по ней же лежит результат его проверки
+	index := make(map[string]int, len(rawURLs))
+	unique := make([]string, 0, len(rawURLs))
+	for i, rawURL := range rawURLs {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidURL, err)
+		}
+
+		hosts[i] = u.Hostname()
+		if _, ok := index[hosts[i]]; !ok {
+			index[hosts[i]] = len(unique)
+			unique = append(unique, hosts[i])
+		}
+	}
+
+	errs := make([]error, len(unique))
+	sem := make(chan struct{}, maxParallelLookups)
+	var wg sync.WaitGroup
+	for i, host := range unique {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			errs[i] = g.checkHost(ctx, host)
+		}()
+	}
+	wg.Wait()
+
+	for _, host := range hosts {
+		if err := errs[index[host]]; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *PrivateNetworkGuard) checkHost(ctx context.Context, host string) error {
+	addrs, err := g.lookup(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: %w: %v", ErrInvalidURL, ErrUnresolvableHost, err)
+	}
+
+	for _, addr := range addrs {
+		if g.isDenied(addr) {
+			return ErrPrivateDestination
+		}
+	}
+
+	return nil
+}
+
+func (g *PrivateNetworkGuard) lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	addrs, err := g.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+
+	return addrs, nil
+}
+
+func (g *PrivateNetworkGuard) isDenied(addr netip.Addr) bool {
+	// ::ffff:10.0.0.1 проверяем как 10.0.0.1
+	addr = addr.Unmap()
+
+	for _, prefix := range g.allowed {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return true
+	}
+
+	for _, prefix := range internalPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	maxPasswordAttempts = 5
+	passwordLockout     = 15 * time.Minute
+	// MaxPasswordLength наибольшая длина пароля в байтах, длиннее bcrypt не принимает
+	MaxPasswordLength = 72
+)
+
+var (
+	ErrPasswordRequired = errors.New("URL is password protected")
+	ErrInvalidPassword  = errors.New("invalid password")
+	ErrLinkLocked       = errors.New("too many failed password attempts")
+	ErrPasswordTooLong  = fmt.Errorf("password must not exceed %d bytes", MaxPasswordLength)
+)
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func checkPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+type passwordAttempt struct {
+	failures    int
+	lockedUntil time.Time
+}
+
+// passwordGuard считает неудачные попытки ввода пароля по каждой ссылке
+// и блокирует ссылку после maxPasswordAttempts ошибок подряд
+type passwordGuard struct {
+	mu       sync.Mutex
+	attempts map[string]*passwordAttempt
+}
+
+func newPasswordGuard() *passwordGuard {
+	return &passwordGuard{
+		attempts: make(map[string]*passwordAttempt),
+	}
+}
+
+func (g *passwordGuard) isLocked(shortID string, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a, ok := g.attempts[shortID]
+	return ok && now.Before(a.lockedUntil)
+}
+
+func (g *passwordGuard) fail(shortID string, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a, ok := g.attempts[shortID]
+	if !ok {
+		a = &passwordAttempt{}
+		g.attempts[shortID] = a
+	}
+
+	a.failures++
+	if a.failures >= maxPasswordAttempts {
+		a.lockedUntil = now.Add(passwordLockout)
+		a.failures = 0
+	}
+}
+
+func (g *passwordGuard) reset(shortID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.attempts, shortID)
+}
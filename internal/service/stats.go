@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Gustik/shortener/internal/model"
+	"github.com/Gustik/shortener/internal/repository"
+)
+
+const statsTopSize = 10
+
+var (
+	ErrNotOwner           = errors.New("URL belongs to another user")
+	ErrInvalidGranularity = errors.New("granularity must be hour or day")
+)
+
+func (s *urlService) GetURLStats(ctx context.Context, userID, shortID, granularity string) (*model.LinkStatsResponse, error) {
+	if granularity == "" {
+		granularity = model.GranularityDay
+	}
+
+	if granularity != model.GranularityHour && granularity != model.GranularityDay {
+		return nil, ErrInvalidGranularity
+	}
+
+	url, err := s.repo.GetByShortURL(ctx, shortID)
+	if errors.Is(err, repository.ErrURLNotFound) {
+		return nil, ErrURLNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if userID == "" || url.UserID != userID {
+		return nil, ErrNotOwner
+	}
+
+	agg, err := s.repo.GetClickAggregate(ctx, shortID, granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	families := make(map[string]int64)
+	for ua, count := range agg.UserAgents {
+		families[userAgentFamily(ua)] += count
+	}
+
+	referrers := make(map[string]int64, len(agg.Referrers))
+	for ref, count := range agg.Referrers {
+		if ref == "" {
+			ref = "(direct)"
+		}
+		referrers[ref] += count
+	}
+
+	return &model.LinkStatsResponse{
+		ShortURL:       fmt.Sprintf("%s/%s", s.baseURL, url.ShortURL),
+		TotalClicks:    agg.Total,
+		UniqueVisitors: agg.Unique,
+		FirstClick:     agg.FirstClick,
+		LastClick:      agg.LastClick,
+		Granularity:    granularity,
+		Buckets:        agg.Buckets,
+		TopReferrers:   topEntries(referrers, statsTopSize),
+		TopUserAgents:  topEntries(families, statsTopSize),
+	}, nil
+}
+
+// topEntries возвращает n самых частых значений, при равенстве по алфавиту
+func topEntries(counts map[string]int64, n int) []model.StatsEntry {
+	entries := make([]model.StatsEntry, 0, len(counts))
+	for name, count := range counts {
+		entries = append(entries, model.StatsEntry{Name: name, Count: count})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+
+	return entries
+}
+
+// userAgentFamily определяет семейство клиента по User-Agent.
+// Порядок проверок важен: Edge и Opera содержат Chrome, а Chrome содержит Safari.
+func userAgentFamily(ua string) string {
+	lower := strings.ToLower(ua)
+
+	switch {
+	case ua == "":
+		return "Unknown"
+	case strings.Contains(lower, "bot"), strings.Contains(lower, "spider"), strings.Contains(lower, "crawler"):
+		return "Bot"
+	case strings.HasPrefix(lower, "curl/"):
+		return "curl"
+	case strings.Contains(ua, "Edg/"), strings.Contains(ua, "Edge/"):
+		return "Edge"
+	case strings.Contains(ua, "OPR/"), strings.Contains(ua, "Opera"):
+		return "Opera"
+	case strings.Contains(ua, "Firefox/"), strings.Contains(ua, "FxiOS/"):
+		return "Firefox"
+	case strings.Contains(ua, "Chrome/"), strings.Contains(ua, "CriOS/"):
+		return "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		return "Safari"
+	case strings.Contains(ua, "MSIE"), strings.Contains(ua, "Trident/"):
+		return "Internet Explorer"
+	default:
+		return "Other"
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Gustik/shortener/internal/repository"
+)
+
+const (
+	deleteQueueSize     = 1024
+	deleteBatchSize     = 100
+	deleteFlushInterval = time.Second
+	deleteTimeout       = 10 * time.Second
+)
+
+var (
+	ErrDeleterClosed   = errors.New("URL deleter is closed")
+	ErrDeleteQueueFull = errors.New("URL deletion queue is full")
+)
+
+type deleteTask struct {
+	userID   string
+	shortIDs []string
+}
+
+// URLDeleter удаляет ссылки в фоне. Задачи от всех запросов сливаются в один канал,
+// копятся по пользователям и сбрасываются в репозиторий пачками.
+type URLDeleter struct {
+	repo   repository.URLRepository
+	logger *zap.Logger
+
+	mu     sync.RWMutex
+	closed bool
+	tasks  chan deleteTask
+	done   chan struct{}
+}
+
+func NewURLDeleter(repo repository.URLRepository, logger *zap.Logger) *URLDeleter {
+	d := &URLDeleter{
+		repo:   repo,
+		logger: logger,
+		tasks:  make(chan deleteTask, deleteQueueSize),
+		done:   make(chan struct{}),
+	}
+
+	go d.run()
+
+	return d
+}
+
+// Enqueue ставит ссылки пользователя в очередь на удаление без блокировки.
+// Если очередь заполнена, например из-за медленного хранилища, возвращает ErrDeleteQueueFull.
+func (d *URLDeleter) Enqueue(userID string, shortIDs []string) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return ErrDeleterClosed
+	}
+
+	select {
+	case d.tasks <- deleteTask{userID: userID, shortIDs: shortIDs}:
+		return nil
+	default:
+		return ErrDeleteQueueFull
+	}
+}
+
+// Close перестает принимать задачи и дожидается удаления уже поставленных
+func (d *URLDeleter) Close() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.tasks)
+	}
+	d.mu.Unlock()
+
+	<-d.done
+}
+
+func (d *URLDeleter) run() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(deleteFlushInterval)
+	defer ticker.Stop()
+
+	pending := make(map[string][]string)
+	count := 0
+
+	for {
+		select {
+		case task, ok := <-d.tasks:
+			if !ok {
+				d.flush(pending)
+				return
+			}
+
+			pending[task.userID] = append(pending[task.userID], task.shortIDs...)
+			count += len(task.shortIDs)
+
+			if count >= deleteBatchSize {
+				d.flush(pending)
+				pending = make(map[string][]string)
+				count = 0
+			}
+		case <-ticker.C:
+			if count > 0 {
+				d.flush(pending)
+				pending = make(map[string][]string)
+				count = 0
+			}
+		}
+	}
+}
+
+func (d *URLDeleter) flush(pending map[string][]string) {
+	for userID, shortIDs := range pending {
+		ctx, cancel := context.WithTimeout(context.Background(), deleteTimeout)
+		err := d.repo.DeleteBatch(ctx, userID, shortIDs)
+		cancel()
+
+		if err != nil {
+			d.logger.Error("не удалось удалить ссылки пользователя",
+				zap.String("user_id", userID), zap.Int("count", len(shortIDs)), zap.Error(err))
+		}
+	}
+}
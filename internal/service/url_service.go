@@ -2,11 +2,11 @@ package service
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	"github.com/Gustik/shortener/internal/model"
@@ -15,45 +15,124 @@ import (
 
 const maxSaveRetries = 5
 
+// MaxTTL наибольшее время жизни ссылки
+const MaxTTL = 10 * 365 * 24 * time.Hour
+
 var (
 	ErrEmptyURL           = errors.New("URL cannot be empty")
 	ErrEmptyURLBatch      = errors.New("URL batch cannot be empty")
 	ErrEmptyShortID       = errors.New("ShortID cannot be empty")
+	ErrEmptyUserID        = errors.New("UserID cannot be empty")
+	ErrEmptyShortIDBatch  = errors.New("ShortID batch cannot be empty")
+	ErrURLDeleted         = errors.New("URL has been deleted")
+	ErrURLExpired         = errors.New("URL has expired")
+	ErrInvalidExpiry      = errors.New("expiry must be in the future")
+	ErrTTLTooLong         = fmt.Errorf("%w: ttl must not exceed %d seconds", ErrInvalidExpiry, int64(MaxTTL/time.Second))
+	ErrInvalidMaxClicks   = errors.New("max clicks cannot be negative")
+	ErrLinkExhausted      = errors.New("link click limit exhausted")
 	ErrURLNotFound        = errors.New("URL not found")
 	ErrURLExists          = errors.New("URL already exists")
 	ErrMaxRetriesExceeded = errors.New("maximum retry attempts exceeded for generating unique short URL")
 )
 
+// ShortenOptions дополнительные параметры создания короткой ссылки
+type ShortenOptions struct {
+	CustomAlias string
+	// ExpiresAt и TTL взаимоисключающие, TTL отсчитывается от момента создания
+	ExpiresAt *time.Time
+	TTL       time.Duration
+	// MaxClicks ограничивает число переходов, 0 - без ограничения
+	MaxClicks int64
+	Password  string
+}
+
+// ShortIDGenerator выдает идентификаторы для новых коротких ссылок.
+// attempt растет с каждым повтором после коллизии, детерминированные стратегии
+// учитывают его, чтобы не выдать занятый идентификатор снова.
+type ShortIDGenerator interface {
+	Generate(ctx context.Context, originalURL string, attempt int) (string, error)
+}
+
 type URLService interface {
-	ShortenURL(ctx context.Context, originalURL string) (string, error)
-	ShortenURLBatch(ctx context.Context, urls []model.BatchRequest) ([]model.BatchResponse, error)
+	ShortenURL(ctx context.Context, originalURL, userID string, opts ShortenOptions) (string, error)
+	ShortenURLBatch(ctx context.Context, urls []model.BatchRequest, userID string) ([]model.BatchResponse, error)
 	GetOriginalURL(ctx context.Context, shortID string) (string, error)
+	// GetShortURL возвращает полную короткую ссылку, если по ней можно перейти:
+	// она существует, не удалена, не просрочена и не заблокирована правилами
+	GetShortURL(ctx context.Context, shortID string) (string, error)
+	// GetURLInfo возвращает сведения о ссылке для страницы предпросмотра, переход не списывается
+	GetURLInfo(ctx context.Context, shortID string) (*model.LinkInfoResponse, error)
+	// UnlockURL проверяет пароль защищенной ссылки и возвращает исходный URL
+	UnlockURL(ctx context.Context, shortID, password string) (string, error)
+	// RecordClick асинхронно сохраняет переход по ссылке
+	RecordClick(click model.Click)
+	// GetURLStats возвращает статистику переходов, доступна только владельцу ссылки
+	GetURLStats(ctx context.Context, userID, shortID, granularity string) (*model.LinkStatsResponse, error)
+	GetInternalStats(ctx context.Context) (*model.InternalStatsResponse, error)
+	GetUserURLs(ctx context.Context, userID string) ([]model.UserURLResponse, error)
+	DeleteUserURLs(ctx context.Context, userID string, shortIDs []string) error
 	Ping(ctx context.Context) error
 }
 
 type urlService struct {
-	repo    repository.URLRepository
-	baseURL string
-	logger  *zap.Logger
+	repo      repository.URLRepository
+	deleter   *URLDeleter
+	clicks    *ClickRecorder
+	passwords *passwordGuard
+	ids       ShortIDGenerator
+	urls      *URLValidator
+	baseURL   string
+	logger    *zap.Logger
 }
 
-func NewURLService(repo repository.URLRepository, baseURL string, logger *zap.Logger) URLService {
+func NewURLService(repo repository.URLRepository, deleter *URLDeleter, clicks *ClickRecorder, ids ShortIDGenerator, urls *URLValidator, baseURL string, logger *zap.Logger) URLService {
 	return &urlService{
-		repo:    repo,
-		baseURL: baseURL,
-		logger:  logger,
+		repo:      repo,
+		deleter:   deleter,
+		clicks:    clicks,
+		passwords: newPasswordGuard(),
+		ids:       ids,
+		urls:      urls,
+		baseURL:   baseURL,
+		logger:    logger,
 	}
 }
 
-func (s *urlService) ShortenURL(ctx context.Context, originalURL string) (string, error) {
+func (s *urlService) ShortenURL(ctx context.Context, originalURL, userID string, opts ShortenOptions) (string, error) {
 	if originalURL == "" {
 		return "", ErrEmptyURL
 	}
 
-	for range maxSaveRetries {
-		shortURL := s.generateShortURL()
+	originalURL, err := s.urls.Normalize(originalURL)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.urls.CheckDestination(originalURL); err != nil {
+		return "", err
+	}
+
+	if err := s.urls.CheckNetwork(ctx, originalURL); err != nil {
+		return "", err
+	}
+
+	record, err := newRecord(originalURL, userID, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.CustomAlias != "" {
+		return s.shortenWithAlias(ctx, record, opts.CustomAlias)
+	}
+
+	for attempt := range maxSaveRetries {
+		shortURL, err := s.ids.Generate(ctx, originalURL, attempt)
+		if err != nil {
+			return "", fmt.Errorf("не удалось сгенерировать short_url: %w", err)
+		}
+		record.ShortURL = shortURL
 
-		savedURL, err := s.repo.Save(ctx, shortURL, originalURL)
+		savedURL, err := s.repo.Save(ctx, record)
 		if errors.Is(err, repository.ErrURLConflict) {
 			s.logger.Sugar().Infof("%s", err.Error())
 			return fmt.Sprintf("%s/%s", s.baseURL, savedURL.ShortURL), ErrURLExists
@@ -76,57 +155,422 @@ func (s *urlService) ShortenURL(ctx context.Context, originalURL string) (string
 	return "", ErrMaxRetriesExceeded
 }
 
-func (s *urlService) ShortenURLBatch(ctx context.Context, urls []model.BatchRequest) ([]model.BatchResponse, error) {
+// shortenWithAlias сохраняет ссылку под выбранным пользователем alias без повторных попыток
+func (s *urlService) shortenWithAlias(ctx context.Context, record model.URLRecord, alias string) (string, error) {
+	if err := validateAlias(alias); err != nil {
+		return "", err
+	}
+
+	record.ShortURL = alias
+	savedURL, err := s.repo.Save(ctx, record)
+	if errors.Is(err, repository.ErrURLConflict) {
+		return fmt.Sprintf("%s/%s", s.baseURL, savedURL.ShortURL), ErrURLExists
+	}
+
+	if errors.Is(err, repository.ErrShortURLConflict) {
+		return "", ErrAliasTaken
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/%s", s.baseURL, savedURL.ShortURL), nil
+}
+
+func (s *urlService) ShortenURLBatch(ctx context.Context, urls []model.BatchRequest, userID string) ([]model.BatchResponse, error) {
 	if len(urls) == 0 {
 		return nil, ErrEmptyURLBatch
 	}
 
 	records := make([]model.URLRecord, len(urls))
+	aliases := make(map[string]struct{})
 	for i := range urls {
 		if urls[i].OriginalURL == "" {
 			return nil, ErrEmptyURL
 		}
-		records[i] = model.URLRecord{
-			ShortURL:    s.generateShortURL(),
-			OriginalURL: urls[i].OriginalURL,
+
+		originalURL, err := s.urls.Normalize(urls[i].OriginalURL)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.urls.CheckDestination(originalURL); err != nil {
+			return nil, err
+		}
+
+		ttl, err := TTLFromSeconds(urls[i].TTL)
+		if err != nil {
+			return nil, err
+		}
+
+		record, err := newRecord(originalURL, userID, ShortenOptions{
+			ExpiresAt: urls[i].ExpiresAt,
+			TTL:       ttl,
+			MaxClicks: urls[i].MaxClicks,
+			Password:  urls[i].Password,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		shortURL := urls[i].CustomAlias
+		if shortURL != "" {
+			if err := validateAlias(shortURL); err != nil {
+				return nil, err
+			}
+			if _, ok := aliases[shortURL]; ok {
+				return nil, ErrAliasTaken
+			}
+			aliases[shortURL] = struct{}{}
+		}
+
+		// UUID выдаем заранее, чтобы по ответу хранилища отличить новые записи от существующих
+		record.UUID = uuid.New()
+		record.ShortURL = shortURL
+		records[i] = record
+	}
+
+	// Сеть проверяем одним вызовом после остальных проверок, чтобы не ждать DNS для заведомо неверной пачки
+	originals := make([]string, len(records))
+	for i := range records {
+		originals[i] = records[i].OriginalURL
+	}
+	if err := s.urls.CheckNetworkBatch(ctx, originals); err != nil {
+		return nil, err
+	}
+
+	// Генерируем после сбора всех alias, чтобы не занять alias из конца пачки
+	taken := aliases
+	for i := range records {
+		if records[i].ShortURL != "" {
+			continue
+		}
+
+		shortURL, err := s.generateUniqueShortURL(ctx, records[i].OriginalURL, 0, taken)
+		if err != nil {
+			return nil, err
 		}
+		records[i].ShortURL = shortURL
 	}
 
-	savedRecords, err := s.repo.SaveBatch(ctx, records)
+	savedRecords, err := s.saveBatchWithRetries(ctx, urls, records, taken)
 	if err != nil {
 		return nil, err
 	}
 
+	created := make(map[uuid.UUID]struct{}, len(records))
+	for i := range records {
+		created[records[i].UUID] = struct{}{}
+	}
+
 	resp := make([]model.BatchResponse, len(urls))
 	for i := range savedRecords {
+		_, isNew := created[savedRecords[i].UUID]
 		resp[i] = model.BatchResponse{
 			CorrelationID: urls[i].CorrelationID,
 			ShortURL:      fmt.Sprintf("%s/%s", s.baseURL, savedRecords[i].ShortURL),
+			Existing:      !isNew,
 		}
 	}
 
 	return resp, nil
 }
 
+// saveBatchWithRetries сохраняет пачку и при случайных коллизиях short_url
+// перегенерирует идентификаторы только у конфликтующих записей.
+// taken содержит short_url пачки и пополняется новыми.
+func (s *urlService) saveBatchWithRetries(ctx context.Context, urls []model.BatchRequest, records []model.URLRecord, taken map[string]struct{}) ([]model.URLRecord, error) {
+	for attempt := range maxSaveRetries {
+		savedRecords, err := s.repo.SaveBatch(ctx, records)
+
+		var conflict *repository.ShortURLConflictError
+		if !errors.As(err, &conflict) {
+			return savedRecords, err
+		}
+
+		for _, i := range conflict.Indexes {
+			if urls[i].CustomAlias != "" {
+				return nil, ErrAliasTaken
+			}
+		}
+
+		s.logger.Info("коллизия short_url в пачке, генерируем заново", zap.Int("count", len(conflict.Indexes)))
+		for _, i := range conflict.Indexes {
+			shortURL, err := s.generateUniqueShortURL(ctx, records[i].OriginalURL, attempt+1, taken)
+			if err != nil {
+				return nil, err
+			}
+			records[i].ShortURL = shortURL
+		}
+	}
+
+	s.logger.Sugar().Errorf("не удалось сгенерировать уникальные short_url для пачки после %d попыток", maxSaveRetries)
+
+	return nil, ErrMaxRetriesExceeded
+}
+
 func (s *urlService) GetOriginalURL(ctx context.Context, shortID string) (string, error) {
+	url, err := s.getActiveRecord(ctx, shortID)
+	if err != nil {
+		return "", err
+	}
+
+	if url.PasswordHash != "" {
+		return "", ErrPasswordRequired
+	}
+
+	if err := s.useClick(ctx, url); err != nil {
+		return "", err
+	}
+
+	return url.OriginalURL, nil
+}
+
+func (s *urlService) GetShortURL(ctx context.Context, shortID string) (string, error) {
+	// Те же проверки, что и при переходе, чтобы не выдавать QR-код неработающей ссылки
+	url, err := s.getActiveRecord(ctx, shortID)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/%s", s.baseURL, url.ShortURL), nil
+}
+
+func (s *urlService) GetURLInfo(ctx context.Context, shortID string) (*model.LinkInfoResponse, error) {
+	// Те же проверки, что и при переходе через GetOriginalURL, но без списания перехода
+	url, err := s.getActiveRecord(ctx, shortID)
+	if err != nil {
+		return nil, err
+	}
+
+	clicks, err := s.repo.CountClicks(ctx, url.ShortURL)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &model.LinkInfoResponse{
+		ShortURL:          fmt.Sprintf("%s/%s", s.baseURL, url.ShortURL),
+		PasswordProtected: url.PasswordHash != "",
+		CreatedAt:         url.CreatedAt,
+		ExpiresAt:         url.ExpiresAt,
+		ClicksLeft:        url.ClicksLeft,
+		Clicks:            clicks,
+	}
+
+	if !info.PasswordProtected {
+		info.OriginalURL = url.OriginalURL
+	}
+
+	return info, nil
+}
+
+func (s *urlService) UnlockURL(ctx context.Context, shortID, password string) (string, error) {
+	url, err := s.getActiveRecord(ctx, shortID)
+	if err != nil {
+		return "", err
+	}
+
+	if url.PasswordHash != "" {
+		now := time.Now()
+		if s.passwords.isLocked(shortID, now) {
+			return "", ErrLinkLocked
+		}
+
+		if !checkPassword(url.PasswordHash, password) {
+			s.passwords.fail(shortID, now)
+			return "", ErrInvalidPassword
+		}
+
+		s.passwords.reset(shortID)
+	}
+
+	if err := s.useClick(ctx, url); err != nil {
+		return "", err
+	}
+
+	return url.OriginalURL, nil
+}
+
+// getActiveRecord возвращает запись, если по ссылке еще можно перейти
+func (s *urlService) getActiveRecord(ctx context.Context, shortID string) (*model.URLRecord, error) {
 	if shortID == "" {
-		return "", ErrEmptyShortID
+		return nil, ErrEmptyShortID
 	}
 
 	url, err := s.repo.GetByShortURL(ctx, shortID)
 	if errors.Is(err, repository.ErrURLNotFound) {
-		return "", ErrURLNotFound
+		return nil, ErrURLNotFound
 	}
 
-	return url.OriginalURL, nil
+	if err != nil {
+		return nil, err
+	}
+
+	if url.IsDeleted {
+		return nil, ErrURLDeleted
+	}
+
+	if url.IsExpired(time.Now()) {
+		return nil, ErrURLExpired
+	}
+
+	if err := s.urls.CheckDestination(url.OriginalURL); err != nil {
+		return nil, err
+	}
+
+	return url, nil
+}
+
+// useClick списывает переход у ссылки с ограничением по числу переходов
+func (s *urlService) useClick(ctx context.Context, url *model.URLRecord) error {
+	if url.ClicksLeft == nil {
+		return nil
+	}
+
+	_, err := s.repo.UseClick(ctx, url.ShortURL)
+	if errors.Is(err, repository.ErrLinkExhausted) {
+		return ErrLinkExhausted
+	}
+
+	return err
+}
+
+func (s *urlService) GetUserURLs(ctx context.Context, userID string) ([]model.UserURLResponse, error) {
+	if userID == "" {
+		return nil, ErrEmptyUserID
+	}
+
+	records, err := s.repo.GetByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]model.UserURLResponse, len(records))
+	for i := range records {
+		resp[i] = model.UserURLResponse{
+			ShortURL:    fmt.Sprintf("%s/%s", s.baseURL, records[i].ShortURL),
+			OriginalURL: records[i].OriginalURL,
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *urlService) DeleteUserURLs(ctx context.Context, userID string, shortIDs []string) error {
+	if userID == "" {
+		return ErrEmptyUserID
+	}
+
+	if len(shortIDs) == 0 {
+		return ErrEmptyShortIDBatch
+	}
+
+	return s.deleter.Enqueue(userID, shortIDs)
+}
+
+func (s *urlService) RecordClick(click model.Click) {
+	if click.ClickedAt.IsZero() {
+		click.ClickedAt = time.Now().UTC()
+	}
+	s.clicks.Record(click)
+}
+
+func (s *urlService) GetInternalStats(ctx context.Context) (*model.InternalStatsResponse, error) {
+	urls, err := s.repo.CountURLs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := s.repo.CountUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.InternalStatsResponse{URLs: urls, Users: users}, nil
 }
 
 func (s *urlService) Ping(ctx context.Context) error {
 	return s.repo.Ping(ctx)
 }
 
-func (s *urlService) generateShortURL() string {
-	b := make([]byte, 6)
-	rand.Read(b)
-	return base64.URLEncoding.EncodeToString(b)[:8]
+// TTLFromSeconds переводит время жизни из секунд в time.Duration.
+// Слишком большое значение отклоняется до умножения, иначе оно переполнится.
+func TTLFromSeconds(seconds int64) (time.Duration, error) {
+	if seconds < 0 {
+		return 0, ErrInvalidExpiry
+	}
+	if seconds > int64(MaxTTL/time.Second) {
+		return 0, ErrTTLTooLong
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// newRecord собирает запись для сохранения и проверяет ограничения из опций
+func newRecord(originalURL, userID string, opts ShortenOptions) (model.URLRecord, error) {
+	record := model.URLRecord{
+		OriginalURL: originalURL,
+		UserID:      userID,
+	}
+
+	now := time.Now()
+
+	switch {
+	case opts.ExpiresAt != nil && opts.TTL != 0:
+		return record, ErrInvalidExpiry
+	case opts.ExpiresAt != nil:
+		if !opts.ExpiresAt.After(now) {
+			return record, ErrInvalidExpiry
+		}
+		expiresAt := opts.ExpiresAt.UTC()
+		record.ExpiresAt = &expiresAt
+	case opts.TTL < 0:
+		return record, ErrInvalidExpiry
+	case opts.TTL > MaxTTL:
+		return record, ErrTTLTooLong
+	case opts.TTL > 0:
+		expiresAt := now.Add(opts.TTL).UTC()
+		record.ExpiresAt = &expiresAt
+	}
+
+	if opts.MaxClicks < 0 {
+		return record, ErrInvalidMaxClicks
+	}
+
+	if opts.MaxClicks > 0 {
+		clicksLeft := opts.MaxClicks
+		record.ClicksLeft = &clicksLeft
+	}
+
+	if len(opts.Password) > MaxPasswordLength {
+		return record, ErrPasswordTooLong
+	}
+
+	if opts.Password != "" {
+		hash, err := hashPassword(opts.Password)
+		if err != nil {
+			return record, fmt.Errorf("не удалось захешировать пароль: %w", err)
+		}
+		record.PasswordHash = hash
+	}
+
+	return record, nil
+}
+
+// generateUniqueShortURL генерирует short_url, которого еще нет в taken, и добавляет его туда.
+// Попытки начинаются с attempt, чтобы повтор после коллизии в хранилище не дал тот же идентификатор.
+func (s *urlService) generateUniqueShortURL(ctx context.Context, originalURL string, attempt int, taken map[string]struct{}) (string, error) {
+	for last := attempt + maxSaveRetries; attempt < last; attempt++ {
+		shortURL, err := s.ids.Generate(ctx, originalURL, attempt)
+		if err != nil {
+			return "", fmt.Errorf("не удалось сгенерировать short_url: %w", err)
+		}
+
+		if _, ok := taken[shortURL]; !ok {
+			taken[shortURL] = struct{}{}
+			return shortURL, nil
+		}
+	}
+
+	return "", ErrMaxRetriesExceeded
 }
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Gustik/shortener/internal/repository"
+)
+
+const sweepTimeout = 30 * time.Second
+
+// URLSweeper периодически помечает удаленными ссылки с истекшим сроком жизни
+type URLSweeper struct {
+	repo     repository.URLRepository
+	interval time.Duration
+	logger   *zap.Logger
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewURLSweeper(repo repository.URLRepository, interval time.Duration, logger *zap.Logger) *URLSweeper {
+	s := &URLSweeper{
+		repo:     repo,
+		interval: interval,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s
+}
+
+// Close останавливает фоновую очистку и дожидается завершения текущего прохода
+func (s *URLSweeper) Close() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *URLSweeper) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.sweep()
+		}
+	}
+}
+
+func (s *URLSweeper) sweep() {
+	ctx, cancel := context.WithTimeout(context.Background(), sweepTimeout)
+	defer cancel()
+
+	count, err := s.repo.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		s.logger.Error("не удалось удалить просроченные ссылки", zap.Error(err))
+		return
+	}
+
+	if count > 0 {
+		s.logger.Info("удалены просроченные ссылки", zap.Int("count", count))
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	ErrInvalidURL       = errors.New("invalid URL")
+	ErrSchemeNotAllowed = errors.New("URL scheme is not allowed")
+	ErrMissingHost      = errors.New("URL host is missing")
+)
+
+// defaultPorts порты, которые не указываются в нормализованном URL
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// NormalizeOptions необязательные шаги нормализации, меняющие смысл URL для некоторых сайтов
+type NormalizeOptions struct {
+	// StripFragment убирает #fragment
+	StripFragment bool
+	// SortQuery сортирует параметры запроса по имени
+	SortQuery bool
+}
+
+// URLValidator проверяет исходные URL перед сохранением и приводит их к единому виду,
+// чтобы разные записи одного адреса совпадали и находились через ErrURLConflict
+type URLValidator struct {
+	schemes map[string]struct{}
+	opts    NormalizeOptions
+	// rules необязательные ограничения адресов назначения
+	rules *DestinationRules
+	// network необязательная проверка, что адрес назначения не во внутренней сети
+	network *PrivateNetworkGuard
+}
+
+func NewURLValidator(allowedSchemes []string, opts NormalizeOptions, rules *DestinationRules, network *PrivateNetworkGuard) *URLValidator {
+	schemes := make(map[string]struct{}, len(allowedSchemes))
+	for _, scheme := range allowedSchemes {
+		schemes[strings.ToLower(scheme)] = struct{}{}
+	}
+
+	return &URLValidator{schemes: schemes, opts: opts, rules: rules, network: network}
+}
+
+// Normalize возвращает нормализованный URL. Ошибки проверки оборачивают ErrInvalidURL.
+func (v *URLValidator) Normalize(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	// Схему url.Parse уже приводит к нижнему регистру
+	if u.Scheme == "" {
+		return "", ErrInvalidURL
+	}
+
+	if _, ok := v.schemes[u.Scheme]; !ok {
+		return "", fmt.Errorf("%w: %w", ErrInvalidURL, ErrSchemeNotAllowed)
+	}
+
+	if u.Opaque != "" || u.Hostname() == "" {
+		return "", fmt.Errorf("%w: %w", ErrInvalidURL, ErrMissingHost)
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	if host == "" {
+		return "", fmt.Errorf("%w: %w", ErrInvalidURL, ErrMissingHost)
+	}
+
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	if v.opts.StripFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+
+	if v.opts.SortQuery && u.RawQuery != "" {
+		// Encode сортирует параметры по имени, порядок значений одного параметра сохраняется
+		u.RawQuery = u.Query().Encode()
+	}
+
+	return u.String(), nil
+}
+
+// CheckDestination проверяет URL по правилам адресов назначения.
+// Вызывается и при сохранении, и при переходе, чтобы новые правила действовали на старые ссылки.
+func (v *URLValidator) CheckDestination(rawURL string) error {
+	if v.rules == nil {
+		return nil
+	}
+
+	return v.rules.Check(rawURL)
+}
+
+// CheckNetwork проверяет, что хост URL не ведет во внутреннюю сеть.
+// Требует разрешения имени, поэтому выполняется только при сохранении ссылки.
+func (v *URLValidator) CheckNetwork(ctx context.Context, rawURL string) error {
+	if v.network == nil {
+		return nil
+	}
+
+	return v.network.Check(ctx, rawURL)
+}
+
+// CheckNetworkBatch как CheckNetwork, но для всей пачки: хосты разрешаются параллельно и по одному разу
+func (v *URLValidator) CheckNetworkBatch(ctx context.Context, rawURLs []string) error {
+	if v.network == nil {
+		return nil
+	}
+
+	return v.network.CheckBatch(ctx, rawURLs)
+}
+
+// normalizeHost приводит хост к нижнему регистру, убирает точку в конце полного имени
+// (evil.ru. и evil.ru - один и тот же хост), а IDN переводит в punycode
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimRight(strings.ToLower(host), ".")
+
+	for i := 0; i < len(host); i++ {
+		if host[i] >= 0x80 {
+			return idna.Lookup.ToASCII(host)
+		}
+	}
+
+	return host, nil
+}
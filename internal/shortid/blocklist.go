@@ -0,0 +1,80 @@
+package shortid
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// maxBlockedAttempts ограничивает число отброшенных подряд кандидатов
+const maxBlockedAttempts = 100
+
+var ErrAllCandidatesBlocked = errors.New("all short id candidates match the blocklist")
+
+// LoadBlocklist читает запрещенные слова из файла, по одному на строку.
+// Пустые строки и строки, начинающиеся с #, пропускаются, регистр не учитывается.
+func LoadBlocklist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("load blocklist: %w", err)
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		words = append(words, word)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("load blocklist: %w", err)
+	}
+
+	return words, nil
+}
+
+// Filtered отбрасывает кандидатов, содержащих слово из списка, и запрашивает следующий.
+// Кандидат проверяется до сохранения, поэтому в хранилище такие идентификаторы не попадают.
+type Filtered struct {
+	next    Generator
+	blocked []string
+}
+
+func NewFiltered(next Generator, blocked []string) *Filtered {
+	return &Filtered{next: next, blocked: blocked}
+}
+
+// Generate для каждого attempt перебирает свой диапазон попыток next, не пересекающийся с соседними.
+// Иначе после отброшенного кандидата повтор сервиса с attempt+1 снова получил бы уже выданный.
+func (g *Filtered) Generate(ctx context.Context, originalURL string, attempt int) (string, error) {
+	for i := range maxBlockedAttempts {
+		// Детерминированным стратегиям нужен новый attempt, иначе вернется тот же кандидат
+		id, err := g.next.Generate(ctx, originalURL, attempt*maxBlockedAttempts+i)
+		if err != nil {
+			return "", err
+		}
+
+		if !g.isBlocked(id) {
+			return id, nil
+		}
+	}
+
+	return "", ErrAllCandidatesBlocked
+}
+
+func (g *Filtered) isBlocked(id string) bool {
+	id = strings.ToLower(id)
+	for _, word := range g.blocked {
+		if strings.Contains(id, word) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,27 @@
+package shortid
+
+import (
+	"context"
+	"fmt"
+)
+
+// Counter кодирует следующее значение счетчика хранилища.
+// Идентификаторы не повторяются, но идут подряд и легко перебираются.
+type Counter struct {
+	seq       Sequence
+	alphabet  string
+	minLength int
+}
+
+func NewCounter(seq Sequence, alphabet string, minLength int) *Counter {
+	return &Counter{seq: seq, alphabet: alphabet, minLength: minLength}
+}
+
+func (g *Counter) Generate(ctx context.Context, originalURL string, attempt int) (string, error) {
+	n, err := g.seq.NextID(ctx)
+	if err != nil {
+		return "", fmt.Errorf("counter short id: %w", err)
+	}
+
+	return encodeUint(n, g.alphabet, g.minLength), nil
+}
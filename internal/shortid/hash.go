@@ -0,0 +1,30 @@
+package shortid
+
+import (
+	"context"
+	"crypto/sha256"
+	"math/big"
+	"strconv"
+)
+
+// Hash выводит идентификатор из SHA-256 исходного URL, один URL всегда дает один идентификатор.
+// При коллизии attempt добавляется к URL, чтобы получить другой вариант.
+type Hash struct {
+	alphabet string
+	length   int
+}
+
+func NewHash(alphabet string, length int) *Hash {
+	return &Hash{alphabet: alphabet, length: length}
+}
+
+func (g *Hash) Generate(ctx context.Context, originalURL string, attempt int) (string, error) {
+	input := originalURL
+	if attempt > 0 {
+		input += "#" + strconv.Itoa(attempt)
+	}
+
+	sum := sha256.Sum256([]byte(input))
+
+	return encodeBig(new(big.Int).SetBytes(sum[:]), g.alphabet, g.length), nil
+}
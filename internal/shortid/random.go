@@ -0,0 +1,42 @@
+package shortid
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+)
+
+// Random генерирует случайные идентификаторы фиксированной длины
+type Random struct {
+	alphabet string
+	length   int
+}
+
+func NewRandom(alphabet string, length int) *Random {
+	return &Random{alphabet: alphabet, length: length}
+}
+
+func (g *Random) Generate(ctx context.Context, originalURL string, attempt int) (string, error) {
+	// Отбрасываем байты из неполного последнего диапазона, чтобы символы были равновероятны
+	limit := byte(256 - 256%len(g.alphabet))
+
+	id := make([]byte, 0, g.length)
+	buf := make([]byte, g.length)
+	for len(id) < g.length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("random short id: %w", err)
+		}
+
+		for _, b := range buf {
+			if b >= limit {
+				continue
+			}
+			id = append(id, g.alphabet[int(b)%len(g.alphabet)])
+			if len(id) == g.length {
+				break
+			}
+		}
+	}
+
+	return string(id), nil
+}
@@ -0,0 +1,67 @@
+// Package shortid содержит стратегии генерации идентификаторов коротких ссылок.
+package shortid
+
+import (
+	"context"
+	"math/big"
+)
+
+const (
+	// Base62Alphabet алфавит по умолчанию, символы безопасны для пути URL
+	Base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// HumanAlphabet удобен для диктовки: только строчные буквы и цифры,
+	// без похожих друг на друга 0/o, 1/l/i и без знаков - и _
+	HumanAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+)
+
+// Generator общий интерфейс стратегий, совпадает с service.ShortIDGenerator
+type Generator interface {
+	Generate(ctx context.Context, originalURL string, attempt int) (string, error)
+}
+
+// Sequence выдает значения монотонного счетчика, его реализует хранилище
+type Sequence interface {
+	NextID(ctx context.Context) (uint64, error)
+}
+
+// encodeUint записывает n в системе счисления алфавита, дополняя слева до minLength
+func encodeUint(n uint64, alphabet string, minLength int) string {
+	base := uint64(len(alphabet))
+
+	var buf []byte
+	for {
+		buf = append(buf, alphabet[n%base])
+		n /= base
+		if n == 0 {
+			break
+		}
+	}
+	for len(buf) < minLength {
+		buf = append(buf, alphabet[0])
+	}
+
+	reverse(buf)
+
+	return string(buf)
+}
+
+// encodeBig берет length младших разрядов n в системе счисления алфавита
+func encodeBig(n *big.Int, alphabet string, length int) string {
+	base := big.NewInt(int64(len(alphabet)))
+	n = new(big.Int).Set(n)
+	mod := new(big.Int)
+
+	buf := make([]byte, length)
+	for i := range buf {
+		n.DivMod(n, base, mod)
+		buf[i] = alphabet[mod.Int64()]
+	}
+
+	return string(buf)
+}
+
+func reverse(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
@@ -0,0 +1,201 @@
+package shortid
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sqidsAlphabet алфавит по умолчанию из спецификации Sqids
+const sqidsAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+type fakeSequence struct {
+	next uint64
+}
+
+func (s *fakeSequence) NextID(ctx context.Context) (uint64, error) {
+	s.next++
+	return s.next, nil
+}
+
+func TestRandom_Generate(t *testing.T) {
+	g := NewRandom(Base62Alphabet, 12)
+
+	seen := make(map[string]struct{})
+	for range 100 {
+		id, err := g.Generate(context.Background(), "https://ya.ru", 0)
+		require.NoError(t, err)
+		assert.Len(t, id, 12)
+		for _, c := range id {
+			assert.True(t, strings.ContainsRune(Base62Alphabet, c), "символ %q вне алфавита", c)
+		}
+		seen[id] = struct{}{}
+	}
+	assert.Len(t, seen, 100)
+}
+
+func TestCounter_Generate(t *testing.T) {
+	tests := []struct {
+		name      string
+		next      uint64
+		minLength int
+		want      string
+	}{
+		{name: "Дополнение до минимальной длины", next: 0, minLength: 4, want: "0001"},
+		{name: "Переход разряда", next: 61, minLength: 1, want: "10"},
+		{name: "Длиннее минимальной длины", next: 62*62 - 1, minLength: 1, want: "100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewCounter(&fakeSequence{next: tt.next}, Base62Alphabet, tt.minLength)
+			id, err := g.Generate(context.Background(), "", 0)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, id)
+		})
+	}
+}
+
+func TestHash_Generate(t *testing.T) {
+	g := NewHash(Base62Alphabet, 8)
+	ctx := context.Background()
+
+	first, err := g.Generate(ctx, "https://ya.ru", 0)
+	require.NoError(t, err)
+	assert.Len(t, first, 8)
+
+	again, _ := g.Generate(ctx, "https://ya.ru", 0)
+	assert.Equal(t, first, again, "один URL дает один идентификатор")
+
+	retry, _ := g.Generate(ctx, "https://ya.ru", 1)
+	assert.NotEqual(t, first, retry, "повтор после коллизии дает другой идентификатор")
+
+	other, _ := g.Generate(ctx, "https://go.dev", 0)
+	assert.NotEqual(t, first, other)
+}
+
+// Ожидаемые значения из тестов спецификации Sqids
+func TestSqids_Encode(t *testing.T) {
+	tests := []struct {
+		name      string
+		numbers   []uint64
+		minLength int
+		want      string
+	}{
+		{name: "Ноль", numbers: []uint64{0}, want: "bM"},
+		{name: "Одно число", numbers: []uint64{1}, want: "Uk"},
+		{name: "Несколько чисел", numbers: []uint64{1, 2, 3}, want: "86Rf07"},
+		{
+			name:      "Минимальная длина",
+			numbers:   []uint64{1, 2, 3},
+			minLength: len(sqidsAlphabet),
+			want:      "86Rf07xd4zBmiJXQG6otHEbew02c3PWsUOLZxADhCpKj7aVFv9I8RquYrNlSTM",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewSqids(nil, sqidsAlphabet, tt.minLength)
+			assert.Equal(t, tt.want, g.encode(tt.numbers))
+		})
+	}
+}
+
+func TestSqids_Generate(t *testing.T) {
+	g := NewSqids(&fakeSequence{}, Base62Alphabet, 6)
+
+	first, err := g.Generate(context.Background(), "", 0)
+	require.NoError(t, err)
+	second, err := g.Generate(context.Background(), "", 0)
+	require.NoError(t, err)
+
+	assert.Len(t, first, 6)
+	assert.Len(t, second, 6)
+	assert.NotEqual(t, first, second)
+}
+
+// stubGenerator возвращает кандидатов по порядку номера попытки
+type stubGenerator struct {
+	ids []string
+}
+
+func (g *stubGenerator) Generate(ctx context.Context, originalURL string, attempt int) (string, error) {
+	return g.ids[attempt%len(g.ids)], nil
+}
+
+func TestFiltered_Generate(t *testing.T) {
+	blocked := []string{"bad", "xxx"}
+
+	tests := []struct {
+		name    string
+		ids     []string
+		want    string
+		wantErr error
+	}{
+		{name: "Разрешенный кандидат", ids: []string{"good123"}, want: "good123"},
+		{name: "Запрещенный кандидат пропускается", ids: []string{"a1bad2", "ok42"}, want: "ok42"},
+		{name: "Регистр не учитывается", ids: []string{"xBADx", "ok42"}, want: "ok42"},
+		{name: "Все кандидаты запрещены", ids: []string{"bad1", "xxx2"}, wantErr: ErrAllCandidatesBlocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewFiltered(&stubGenerator{ids: tt.ids}, blocked)
+			id, err := g.Generate(context.Background(), "", 0)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, id)
+		})
+	}
+}
+
+// Повтор сервиса после коллизии в хранилище не должен получить того же кандидата,
+// даже если на предыдущей попытке Filtered уже пропускал запрещенные
+func TestFiltered_RetryAfterCollision(t *testing.T) {
+	g := NewFiltered(NewHash(Base62Alphabet, 8), nil)
+	ctx := context.Background()
+
+	blockedID, err := NewHash(Base62Alphabet, 8).Generate(ctx, "https://ya.ru", 0)
+	require.NoError(t, err)
+	g.blocked = []string{strings.ToLower(blockedID)}
+
+	first, err := g.Generate(ctx, "https://ya.ru", 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, blockedID, first)
+
+	seen := map[string]struct{}{first: {}}
+	for attempt := 1; attempt < 5; attempt++ {
+		id, err := g.Generate(ctx, "https://ya.ru", attempt)
+		require.NoError(t, err)
+
+		assert.NotContains(t, seen, id, "Попытка %d повторила занятый кандидат", attempt)
+		seen[id] = struct{}{}
+	}
+}
+
+func TestFiltered_HumanAlphabet(t *testing.T) {
+	g := NewFiltered(NewRandom(HumanAlphabet, 8), []string{"a", "b", "c"})
+
+	for range 100 {
+		id, err := g.Generate(context.Background(), "", 0)
+		require.NoError(t, err)
+		assert.NotContains(t, id, "a")
+		assert.False(t, strings.ContainsAny(id, "01ilo-_ABC"), "неудобный символ в %q", id)
+	}
+}
+
+func TestLoadBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# комментарий\nBad\n\n  xxx  \n"), 0o644))
+
+	words, err := LoadBlocklist(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bad", "xxx"}, words)
+
+	_, err = LoadBlocklist(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,89 @@
+package shortid
+
+import (
+	"context"
+	"fmt"
+)
+
+// Sqids кодирует значение счетчика по алгоритму Sqids (https://sqids.org).
+// Идентификаторы уникальны, как у Counter, но соседние значения не похожи друг на друга.
+// Символы алфавита не должны повторяться.
+type Sqids struct {
+	seq       Sequence
+	alphabet  string
+	minLength int
+}
+
+func NewSqids(seq Sequence, alphabet string, minLength int) *Sqids {
+	return &Sqids{seq: seq, alphabet: shuffle(alphabet), minLength: minLength}
+}
+
+func (g *Sqids) Generate(ctx context.Context, originalURL string, attempt int) (string, error) {
+	n, err := g.seq.NextID(ctx)
+	if err != nil {
+		return "", fmt.Errorf("sqids short id: %w", err)
+	}
+
+	return g.encode([]uint64{n}), nil
+}
+
+// encode повторяет encodeNumbers из спецификации без списка запрещенных слов
+func (g *Sqids) encode(numbers []uint64) string {
+	size := len(g.alphabet)
+
+	offset := len(numbers)
+	for i, n := range numbers {
+		offset += int(g.alphabet[n%uint64(size)]) + i
+	}
+	offset %= size
+
+	alphabet := []byte(g.alphabet[offset:] + g.alphabet[:offset])
+	prefix := alphabet[0]
+	reverse(alphabet)
+
+	id := []byte{prefix}
+	for i, n := range numbers {
+		id = append(id, toID(n, alphabet[1:])...)
+		if i < len(numbers)-1 {
+			id = append(id, alphabet[0])
+			alphabet = []byte(shuffle(string(alphabet)))
+		}
+	}
+
+	if len(id) < g.minLength {
+		id = append(id, alphabet[0])
+		for len(id) < g.minLength {
+			alphabet = []byte(shuffle(string(alphabet)))
+			id = append(id, alphabet[:min(g.minLength-len(id), len(alphabet))]...)
+		}
+	}
+
+	return string(id)
+}
+
+func toID(n uint64, alphabet []byte) []byte {
+	base := uint64(len(alphabet))
+
+	var id []byte
+	for {
+		id = append(id, alphabet[n%base])
+		n /= base
+		if n == 0 {
+			break
+		}
+	}
+	reverse(id)
+
+	return id
+}
+
+// shuffle детерминированно перемешивает алфавит, как в спецификации Sqids
+func shuffle(alphabet string) string {
+	chars := []byte(alphabet)
+	for i, j := 0, len(chars)-1; j > 0; i, j = i+1, j-1 {
+		r := (i*j + int(chars[i]) + int(chars[j])) % len(chars)
+		chars[i], chars[r] = chars[r], chars[i]
+	}
+
+	return string(chars)
+}
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_urls_user_id;
+ALTER TABLE urls DROP COLUMN IF EXISTS user_id;
\ No newline at end of file
@@ -0,0 +1,10 @@
+-- Старый индекс не допускает повторов original_url, оставляем по одной записи на URL:
+-- действующую, а если ее нет, то самую новую
+DELETE FROM urls u
+WHERE u.is_deleted AND EXISTS (
+    SELECT 1 FROM urls o
+    WHERE o.original_url = u.original_url AND o.id <> u.id
+      AND (NOT o.is_deleted OR o.created_at > u.created_at)
+);
+DROP INDEX IF EXISTS idx_urls_original_url_active;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_original_url ON urls(original_url);
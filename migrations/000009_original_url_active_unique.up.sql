@@ -0,0 +1,3 @@
+-- Удаленная ссылка не должна мешать сократить тот же URL заново
+DROP INDEX IF EXISTS idx_urls_original_url;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_original_url_active ON urls(original_url) WHERE NOT is_deleted;
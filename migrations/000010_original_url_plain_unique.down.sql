@@ -0,0 +1,16 @@
+-- Старый индекс допускает одну действующую запись на URL, остальные помечаем удаленными:
+-- остается запись без ограничений, а если ее нет, то самая новая
+UPDATE urls u SET is_deleted = TRUE
+WHERE NOT u.is_deleted AND EXISTS (
+    SELECT 1 FROM urls o
+    WHERE o.original_url = u.original_url AND o.id <> u.id AND NOT o.is_deleted
+      AND (
+          (o.expires_at IS NULL AND o.clicks_left IS NULL AND o.password_hash IS NULL)
+          OR (
+              (u.expires_at IS NOT NULL OR u.clicks_left IS NOT NULL OR u.password_hash IS NOT NULL)
+              AND (o.created_at, o.id) > (u.created_at, u.id)
+          )
+      )
+);
+DROP INDEX IF EXISTS idx_urls_original_url_plain;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_original_url_active ON urls(original_url) WHERE NOT is_deleted;
@@ -0,0 +1,5 @@
+-- Ссылки с паролем, лимитом переходов или сроком жизни создаются отдельно для каждого запроса,
+-- уникальным остается только original_url действующих ссылок без ограничений
+DROP INDEX IF EXISTS idx_urls_original_url_active;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_original_url_plain ON urls(original_url)
+    WHERE NOT is_deleted AND expires_at IS NULL AND clicks_left IS NULL AND password_hash IS NULL;